@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envName returns the environment variable that sets a flag, e.g. GORPL_DATA_DIR for -data-dir
+func envName(flagName string) string {
+	return "GORPL_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyConfig fills flags which were not set on the command line from environment variables and a config file
+// The config file is a JSON object with flag names as keys, e.g. {"data-dir": "/var/lib/gorpl", "keep-snapshots": 14}
+// Precedence is: command line, environment, config file, defaults
+func applyConfig(fs *flag.FlagSet, configFlag string) error {
+	setOnCommandLine := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		setOnCommandLine[f.Name] = true
+	})
+
+	setFromEnv := make(map[string]bool)
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || setOnCommandLine[f.Name] {
+			return
+		}
+		if value, ok := os.LookupEnv(envName(f.Name)); ok {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid value of %s: %w", envName(f.Name), setErr)
+				return
+			}
+			setFromEnv[f.Name] = true
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	configFile := fs.Lookup(configFlag).Value.String()
+	if configFile == "" {
+		return nil
+	}
+
+	file, err := os.Open(configFile)
+	if err != nil {
+		return fmt.Errorf("error opening config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.UseNumber()
+
+	var values map[string]interface{}
+	if err := decoder.Decode(&values); err != nil {
+		return fmt.Errorf("error decoding config file %s: %w", configFile, err)
+	}
+
+	for name, value := range values {
+		if fs.Lookup(name) == nil || name == configFlag {
+			return fmt.Errorf("unknown setting in config file %s: %s", configFile, name)
+		}
+		if setOnCommandLine[name] || setFromEnv[name] {
+			continue
+		}
+		if err := fs.Set(name, fmt.Sprint(value)); err != nil {
+			return fmt.Errorf("invalid value of %s in config file %s: %w", name, configFile, err)
+		}
+	}
+
+	return nil
+}
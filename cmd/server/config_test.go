@@ -0,0 +1,164 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		flag string
+		want string
+	}{
+		{"port", "GORPL_PORT"},
+		{"data-dir", "GORPL_DATA_DIR"},
+		{"max-product-drop", "GORPL_MAX_PRODUCT_DROP"},
+	}
+
+	for _, test := range tests {
+		if got := envName(test.flag); got != test.want {
+			t.Errorf("envName(%q) = %q, want %q", test.flag, got, test.want)
+		}
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		env    map[string]string
+		config string
+		// Expected values of data-dir, keep-snapshots and cache
+		dataDir       string
+		keepSnapshots string
+		cache         string
+	}{
+		{
+			name:          "defaults",
+			dataDir:       "data",
+			keepSnapshots: "7",
+			cache:         "true",
+		},
+		{
+			name:          "config file",
+			config:        `{"data-dir": "/var/lib/gorpl", "keep-snapshots": 14, "cache": false}`,
+			dataDir:       "/var/lib/gorpl",
+			keepSnapshots: "14",
+			cache:         "false",
+		},
+		{
+			name:          "environment over config file",
+			env:           map[string]string{"GORPL_DATA_DIR": "/srv/gorpl", "GORPL_CACHE": "false"},
+			config:        `{"data-dir": "/var/lib/gorpl", "keep-snapshots": 14}`,
+			dataDir:       "/srv/gorpl",
+			keepSnapshots: "14",
+			cache:         "false",
+		},
+		{
+			name:          "command line over environment and config file",
+			args:          []string{"-data-dir", "/tmp/gorpl", "-keep-snapshots=3"},
+			env:           map[string]string{"GORPL_DATA_DIR": "/srv/gorpl", "GORPL_KEEP_SNAPSHOTS": "5"},
+			config:        `{"data-dir": "/var/lib/gorpl", "keep-snapshots": 14}`,
+			dataDir:       "/tmp/gorpl",
+			keepSnapshots: "3",
+			cache:         "true",
+		},
+		{
+			name:          "config file from the environment",
+			env:           map[string]string{"GORPL_CONFIG": "config.json"},
+			config:        `{"keep-snapshots": 30}`,
+			dataDir:       "data",
+			keepSnapshots: "30",
+			cache:         "true",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := testFlagSet()
+			args := test.args
+			dir := t.TempDir()
+			if test.config != "" {
+				configFile := filepath.Join(dir, "config.json")
+				if err := os.WriteFile(configFile, []byte(test.config), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if test.env["GORPL_CONFIG"] == "" {
+					args = append([]string{"-config", configFile}, args...)
+				}
+			}
+			for name, value := range test.env {
+				if name == "GORPL_CONFIG" {
+					value = filepath.Join(dir, value)
+				}
+				t.Setenv(name, value)
+			}
+			if err := fs.Parse(args); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := applyConfig(fs, "config"); err != nil {
+				t.Fatal(err)
+			}
+
+			for name, want := range map[string]string{"data-dir": test.dataDir, "keep-snapshots": test.keepSnapshots, "cache": test.cache} {
+				if got := fs.Lookup(name).Value.String(); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    map[string]string
+		config string
+	}{
+		{"invalid environment value", map[string]string{"GORPL_KEEP_SNAPSHOTS": "many"}, ""},
+		{"invalid config value", nil, `{"keep-snapshots": "many"}`},
+		{"unknown setting", nil, `{"keep-everything": true}`},
+		{"config file in config file", nil, `{"config": "other.json"}`},
+		{"malformed config file", nil, `{"keep-snapshots": `},
+		{"missing config file", map[string]string{"GORPL_CONFIG": "/nonexistent/config.json"}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fs := testFlagSet()
+			var args []string
+			if test.config != "" {
+				configFile := filepath.Join(t.TempDir(), "config.json")
+				if err := os.WriteFile(configFile, []byte(test.config), 0644); err != nil {
+					t.Fatal(err)
+				}
+				args = []string{"-config", configFile}
+			}
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			if err := fs.Parse(args); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := applyConfig(fs, "config"); err == nil {
+				t.Errorf("applyConfig succeeded, want an error")
+			}
+		})
+	}
+}
+
+// testFlagSet returns a flag set with some of the server's flags
+func testFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.String("config", "", "")
+	fs.String("data-dir", "data", "")
+	fs.Int("keep-snapshots", 7, "")
+	fs.Bool("cache", true, "")
+	return fs
+}
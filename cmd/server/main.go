@@ -4,169 +4,151 @@ package main
 import (
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"gorpl/internal/api"
 	"gorpl/internal/database"
+	"gorpl/internal/registry"
+	"gorpl/internal/validation"
+	"gorpl/internal/webhook"
 )
 
-const (
-	// URL for downloading XML file from the medicinal products registry
-	xmlURL = "https://rejestry.ezdrowie.gov.pl/api/rpl/medicinal-products/public-pl-report/6.0.0/overall.xml"
-	// API version
-	apiVersion = "6.0.0"
-)
-
-// getDataFilePath returns the path to the data file based on the current date
-func getDataFilePath() string {
-	currentDate := time.Now().Format("20060102")
-	return fmt.Sprintf("%s_%s.xml", currentDate, apiVersion)
-}
-
-// needsDownload checks if the XML file should be downloaded
-// File is downloaded when it doesn't exist or is from a previous day
-func needsDownload(filePath string) bool {
-	_, err := os.Stat(filePath)
-	if os.IsNotExist(err) {
-		return true
-	}
+// loadLastSnapshot loads the newest previously downloaded snapshot that can be parsed
+// The data is marked as stale, so that clients know it is not today's registry
+func loadLastSnapshot(db *database.ProductDatabase, config registry.Config) (string, error) {
+	snapshots, err := config.Snapshots()
 	if err != nil {
-		log.Printf("Error checking file: %v", err)
-		return true
+		return "", err
 	}
 
-	expected := getDataFilePath()
-	return filepath.Base(filePath) != filepath.Base(expected)
-}
-
-// cleanupAllFiles removes all XML files from the data directory except the current day's file
-func cleanupAllFiles(dataDir string) error {
-	files, err := os.ReadDir(dataDir)
-	if err != nil {
-		return fmt.Errorf("error reading data directory: %w", err)
-	}
-
-	currentFile := getDataFilePath()
-	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".xml") {
-			// Skip the current day's file
-			if filepath.Base(file.Name()) == filepath.Base(currentFile) {
-				continue
-			}
-			
-			filePath := filepath.Join(dataDir, file.Name())
-			if err := os.Remove(filePath); err != nil {
-				log.Printf("Error deleting file %s: %v", filePath, err)
-			} else {
-				log.Printf("Deleted file: %s", filePath)
-			}
+	for _, snapshot := range snapshots {
+		log.Printf("Falling back to previously downloaded file %s...", snapshot)
+		if err := db.LoadFromFile(snapshot); err != nil {
+			log.Printf("Error loading products: %v", err)
+			continue
 		}
+		db.SetStale(true)
+		return snapshot, nil
 	}
-	return nil
-}
 
-// downloadXMLFile downloads the XML file from the medicinal products registry
-func downloadXMLFile(url, filePath string) error {
-	dir := filepath.Dir(filePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("cannot create directory: %w", err)
-	}
+	return "", fmt.Errorf("no previously downloaded data in %s", config.DataDir)
+}
 
-	log.Printf("Downloading file from %s...", url)
-	startTime := time.Now()
+func main() {
+	config := registry.DefaultConfig()
+	var httpConfig registry.HTTPConfig
 
-	resp, err := http.Get(url)
-	if err != nil {
-		return fmt.Errorf("error downloading: %w", err)
-	}
-	defer resp.Body.Close()
+	flag.String("config", "", "Optional path to a JSON config file with flag names as keys")
+	xmlFileFlag := flag.String("file", "", "Optional path to XML file with medicinal products data")
+	port := flag.String("port", "1532", "Port to run the HTTP server on")
+	flag.StringVar(&config.URL, "url", config.URL, "URL of the registry export")
+	flag.StringVar(&config.DeltaURL, "delta-url", "", "URL of the incremental registry export applied on top of yesterday's data (disabled when empty)")
+	flag.StringVar(&config.DataDir, "data-dir", config.DataDir, "Directory for downloaded registry files")
+	flag.StringVar(&config.Version, "api-version", config.Version, "Version of the registry export format, used in file names")
+	flag.StringVar(&config.FileName, "file-name", config.FileName, "Template of data file names, {date} is replaced with YYYYMMDD and {version} with the export version")
+	refreshInterval := flag.Duration("refresh-interval", time.Hour, "How often to check the registry for new data (0 disables refreshing)")
+	flag.DurationVar(&httpConfig.Timeout, "download-timeout", 10*time.Minute, "Timeout for a single registry download attempt")
+	flag.DurationVar(&httpConfig.ConnectTimeout, "connect-timeout", 30*time.Second, "Timeout for connecting to the registry")
+	flag.StringVar(&httpConfig.Proxy, "http-proxy", "", "Proxy URL for registry downloads (HTTP_PROXY/HTTPS_PROXY are used when empty)")
+	flag.StringVar(&httpConfig.CABundle, "ca-bundle", "", "Path to a PEM file with additional trusted CA certificates")
+	downloadRetries := flag.Int("download-retries", 5, "How many times to retry a failed registry download")
+	flag.IntVar(&config.Retention.KeepSnapshots, "keep-snapshots", 7, "How many downloaded snapshots to keep (0 keeps all)")
+	flag.IntVar(&config.Retention.KeepDays, "keep-days", 0, "How many days of downloaded snapshots to keep (0 keeps all)")
+	flag.BoolVar(&config.Retention.Compress, "compress-snapshots", false, "Gzip compress snapshots older than the newest one")
+	minProducts := flag.Int("min-products", 1, "Minimum number of products a new snapshot must contain")
+	maxProductDrop := flag.Float64("max-product-drop", 10, "Maximum drop of the product count in a new snapshot, in percent (0 disables the check)")
+	maxGtinDrop := flag.Float64("max-gtin-drop", 10, "Maximum drop of GTIN index entries in a new snapshot, in percent (0 disables the check)")
+	validate := flag.Bool("validate", true, "Validate downloaded snapshots against the bundled XSD schemas")
+	useCache := flag.Bool("cache", true, "Keep a binary cache of parsed data next to the XML file for faster startup")
+	webhookTimeout := flag.Duration("webhook-timeout", 30*time.Second, "Timeout for a single webhook delivery attempt")
+	webhookAttempts := flag.Int("webhook-attempts", 5, "How many times to try delivering a webhook notification")
+	adminToken := flag.String("admin-token", "", "Token required by the admin API (admin API is disabled when empty)")
+	flag.Parse()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("invalid HTTP status: %d", resp.StatusCode)
+	// Every flag can also be set with a GORPL_* environment variable or in the config file
+	if err := applyConfig(flag.CommandLine, "config"); err != nil {
+		log.Fatalf("Error reading configuration: %v", err)
 	}
-
-	tempFile := filePath + ".tmp"
-	out, err := os.Create(tempFile)
-	if err != nil {
-		return fmt.Errorf("cannot create temporary file: %w", err)
+	if err := config.Check(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
 	}
-	defer out.Close()
 
-	n, err := io.Copy(out, resp.Body)
+	client, err := registry.NewHTTPClient(httpConfig)
 	if err != nil {
-		os.Remove(tempFile)
-		return fmt.Errorf("error saving data: %w", err)
-	}
-
-	out.Close()
-
-	if err := os.Rename(tempFile, filePath); err != nil {
-		os.Remove(tempFile)
-		return fmt.Errorf("cannot rename file: %w", err)
+		log.Fatalf("Invalid HTTP client configuration: %v", err)
 	}
-
-	log.Printf("Downloaded %d bytes in %v", n, time.Since(startTime))
-
-	// Clean up old files only after successful download
-	if err := cleanupAllFiles(dir); err != nil {
-		log.Printf("Warning: error during cleanup: %v", err)
+	downloader := registry.NewDownloader(client, *downloadRetries)
+	activation := registry.ActivationPolicy{
+		MinProducts:    *minProducts,
+		MaxProductDrop: *maxProductDrop,
+		MaxGtinDrop:    *maxGtinDrop,
 	}
 
-	return nil
-}
+	db := database.NewProductDatabase()
+	db.SetCacheEnabled(*useCache)
+	startTime := time.Now()
 
-// ensureDataFile ensures that the XML file is available and up to date
-func ensureDataFile(providedFile string) (string, error) {
-	if providedFile != "" && providedFile != getDataFilePath() {
-		if _, err := os.Stat(providedFile); err == nil {
-			log.Printf("Using user-provided file: %s", providedFile)
-			return providedFile, nil
+	var report *validation.Report
+	xmlFile, err := config.EnsureDataFile(downloader, *xmlFileFlag)
+	if err == nil {
+		if *validate {
+			report = registry.ValidateSnapshot(xmlFile)
+		}
+		log.Printf("Loading products from %s...", xmlFile)
+		if err := db.LoadFromFile(xmlFile); err != nil {
+			log.Fatalf("Error loading products: %v", err)
+		}
+		// Downloaded files are checked before use, user-provided files are trusted
+		if xmlFile == config.DataFilePath() {
+			log.Printf("Checking %s against the previously active data...", xmlFile)
+			if reasons := activation.Check(config.ActiveSummary(), db.Summary()); len(reasons) > 0 {
+				if err := registry.Quarantine(xmlFile, db.Summary(), reasons); err != nil {
+					log.Printf("Error quarantining %s: %v", xmlFile, err)
+				}
+				err = fmt.Errorf("snapshot %s rejected: %v", xmlFile, reasons)
+			}
 		}
-		log.Printf("Provided file does not exist: %s", providedFile)
 	}
-
-	filePath := getDataFilePath()
-
-	if needsDownload(filePath) {
-		log.Printf("File %s needs to be downloaded", filePath)
-		if err := downloadXMLFile(xmlURL, filePath); err != nil {
-			return "", fmt.Errorf("cannot download file: %w", err)
+	if err != nil {
+		log.Printf("Error preparing data file: %v", err)
+		xmlFile, err = loadLastSnapshot(db, config)
+		if err != nil {
+			log.Fatalf("No data available: %v", err)
 		}
-	} else {
-		log.Printf("Using existing file: %s", filePath)
 	}
 
-	return filePath, nil
-}
-
-func main() {
-	xmlFileFlag := flag.String("file", "", "Optional path to XML file with medicinal products data")
-	port := flag.String("port", "1532", "Port to run the HTTP server on")
-	flag.Parse()
+	loadDuration := time.Since(startTime)
+	stats := db.GetStatistics()
+	log.Printf("Loaded %d products in %v", stats["liczbaProdukow"], loadDuration)
 
-	xmlFile, err := ensureDataFile(*xmlFileFlag)
+	// Keep the data up to date, unless the user pinned a specific file
+	refresher := registry.NewRefresher(db, config, downloader, activation, *validate, xmlFile, *refreshInterval)
+	refresher.SetValidation(report)
+	refresher.SetLoadDuration(loadDuration)
+	notifier, err := webhook.NewNotifier(filepath.Join(config.DataDir, "webhooks.json"), &http.Client{Timeout: *webhookTimeout}, *webhookAttempts)
 	if err != nil {
-		log.Fatalf("Error preparing data file: %v", err)
+		log.Fatalf("Error loading webhooks: %v", err)
 	}
+	refresher.SetChangeListener(notifier.Notify)
 
-	db := database.NewProductDatabase()
-	startTime := time.Now()
-
-	log.Printf("Loading products from %s...", xmlFile)
-	if err := db.LoadFromFile(xmlFile); err != nil {
-		log.Fatalf("Error loading products: %v", err)
+	pinned := xmlFile == *xmlFileFlag && xmlFile != config.DataFilePath()
+	if !pinned {
+		// Old snapshots are only cleaned up once the data loaded at startup is known to be good
+		refresher.ApplyRetention()
+		if err := config.SaveActiveSummary(db.Summary()); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+	if *refreshInterval > 0 && !pinned {
+		refresher.Start()
+		defer refresher.Stop()
 	}
-
-	stats := db.GetStatistics()
-	log.Printf("Loaded %d products in %v", stats["liczbaProdukow"], time.Since(startTime))
 
 	router := gin.Default()
 	router.SetTrustedProxies(nil)
@@ -178,6 +160,10 @@ func main() {
 	}
 
 	handler := api.NewHandler(db)
+	handler.Snapshots = refresher
+	handler.Changes = refresher
+	handler.Webhooks = notifier
+	handler.AdminToken = *adminToken
 	handler.RegisterRoutes(router)
 
 	router.GET("/", func(c *gin.Context) {
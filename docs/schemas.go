@@ -0,0 +1,9 @@
+// Package docs bundles the XSD schemas of the registry export
+package docs
+
+import "embed"
+
+// Schemas holds scheme.xsd and commonTypes.xsd
+//
+//go:embed *.xsd
+var Schemas embed.FS
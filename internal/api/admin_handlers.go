@@ -0,0 +1,235 @@
+// Package api contains HTTP handlers for the API
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"gorpl/internal/database"
+	"gorpl/internal/registry"
+	"gorpl/internal/validation"
+)
+
+// SnapshotManager provides access to registry snapshots stored in the data directory
+type SnapshotManager interface {
+	ListSnapshots() ([]registry.SnapshotInfo, error)
+	Rollback(name string) error
+	ListRejections() ([]registry.Rejection, error)
+	Validation() *validation.Report
+	ValidateSnapshot(name string) (*validation.Report, error)
+	TriggerRefresh() error
+	LoadFile(name string) error
+	Status() registry.Status
+	Upload(src io.Reader) (*validation.Report, error)
+	ApplyDelta(name string) error
+	Changes() []*database.ChangeSet
+}
+
+// LoadFileRequest is the body of a request to load a file from the data directory
+// With Delta set, the file is applied as an incremental export on top of the current data
+type LoadFileRequest struct {
+	File  string `json:"file" binding:"required"`
+	Delta bool   `json:"delta"`
+}
+
+// requireAdminToken rejects requests without a valid "Authorization: Bearer <token>" header
+func (h *Handler) requireAdminToken(c *gin.Context) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.AdminToken)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or missing admin token"})
+		return
+	}
+	c.Next()
+}
+
+// ListSnapshots handles requests for the list of stored snapshots
+func (h *Handler) ListSnapshots(c *gin.Context) {
+	snapshots, err := h.Snapshots.ListSnapshots()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, snapshots)
+}
+
+// ListRejectedSnapshots handles requests for snapshots rejected by the activation checks
+func (h *Handler) ListRejectedSnapshots(c *gin.Context) {
+	rejections, err := h.Snapshots.ListRejections()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rejections)
+}
+
+// RollbackSnapshot handles requests to reload an older snapshot
+func (h *Handler) RollbackSnapshot(c *gin.Context) {
+	name := c.Param("name")
+
+	if err := h.Snapshots.Rollback(name); err != nil {
+		if errors.Is(err, registry.ErrSnapshotNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Snapshot not found"})
+			return
+		}
+		if errors.Is(err, registry.ErrRefreshInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Data is already being refreshed"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.DB.GetStatistics())
+}
+
+// GetValidationReport handles requests for the validation report of the last downloaded snapshot
+func (h *Handler) GetValidationReport(c *gin.Context) {
+	report := h.Snapshots.Validation()
+	if report == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No snapshot has been validated"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ValidateSnapshot handles requests to validate a stored snapshot against the schema
+func (h *Handler) ValidateSnapshot(c *gin.Context) {
+	report, err := h.Snapshots.ValidateSnapshot(c.Param("name"))
+	if err != nil {
+		if errors.Is(err, registry.ErrSnapshotNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Snapshot not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// TriggerRefresh handles requests to download and reload the registry in the background
+func (h *Handler) TriggerRefresh(c *gin.Context) {
+	if err := h.Snapshots.TriggerRefresh(); err != nil {
+		if errors.Is(err, registry.ErrRefreshInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Data is already being refreshed"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, h.Snapshots.Status())
+}
+
+// LoadFile handles requests to load a file from the data directory
+func (h *Handler) LoadFile(c *gin.Context) {
+	var request LoadFileRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing file name"})
+		return
+	}
+
+	load := h.Snapshots.LoadFile
+	if request.Delta {
+		load = h.Snapshots.ApplyDelta
+	}
+
+	if err := load(request.File); err != nil {
+		if errors.Is(err, registry.ErrSnapshotNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			return
+		}
+		if errors.Is(err, registry.ErrRefreshInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Data is already being refreshed"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.Snapshots.Status())
+}
+
+// ListChanges handles requests for the changes applied from incremental exports
+func (h *Handler) ListChanges(c *gin.Context) {
+	c.JSON(http.StatusOK, h.Snapshots.Changes())
+}
+
+// GetStatus handles requests for the state of data ingestion
+func (h *Handler) GetStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, h.Snapshots.Status())
+}
+
+// UploadSnapshot handles multipart uploads of registry exports (.xml or .xml.gz) in the "file" field
+func (h *Handler) UploadSnapshot(c *gin.Context) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing file"})
+		return
+	}
+	if !strings.HasSuffix(header.Filename, ".xml") && !strings.HasSuffix(header.Filename, ".xml.gz") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only .xml and .xml.gz files are accepted"})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	report, err := h.Snapshots.Upload(file)
+	if err != nil {
+		switch {
+		case errors.Is(err, registry.ErrInvalidUpload):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, registry.ErrSnapshotRejected):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "validation": report})
+		case errors.Is(err, registry.ErrRefreshInProgress):
+			c.JSON(http.StatusConflict, gin.H{"error": "Data is already being refreshed"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": h.Snapshots.Status(), "validation": report})
+}
+
+// RegisterAdminRoutes registers admin API routes
+// The routes are only available when an admin token is configured
+func (h *Handler) RegisterAdminRoutes(router *gin.Engine) {
+	if h.AdminToken == "" || h.Snapshots == nil {
+		return
+	}
+
+	admin := router.Group("/api/v1/admin", h.requireAdminToken)
+	{
+		admin.GET("/snapshots", h.ListSnapshots)
+		admin.POST("/snapshots/:name/rollback", h.RollbackSnapshot)
+		admin.GET("/snapshots/:name/validation", h.ValidateSnapshot)
+		admin.GET("/quarantine", h.ListRejectedSnapshots)
+		admin.GET("/validation", h.GetValidationReport)
+		admin.GET("/status", h.GetStatus)
+		admin.POST("/reload", h.TriggerRefresh)
+		admin.POST("/load", h.LoadFile)
+		admin.POST("/upload", h.UploadSnapshot)
+		admin.GET("/deltas", h.ListChanges)
+	}
+
+	if h.Webhooks != nil {
+		admin.GET("/webhooks", h.ListWebhooks)
+		admin.POST("/webhooks", h.AddWebhook)
+		admin.DELETE("/webhooks/:id", h.RemoveWebhook)
+		admin.GET("/webhooks/deliveries", h.ListWebhookDeliveries)
+	}
+}
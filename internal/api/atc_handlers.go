@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"gorpl/internal/database"
+)
+
+// AtcResponse describes a group of the ATC hierarchy with its subgroups and products
+type AtcResponse struct {
+	Code     string              `json:"code"`
+	Level    int                 `json:"level"`
+	Products int                 `json:"products"`
+	Groups   []database.AtcGroup `json:"groups"`
+	// Page of the products in the group, missing when products are not listed
+	*Page[productResult]
+}
+
+// GetAtcGroup handles requests for the products and subgroups of an ATC group
+// The code can be given at any level (A, A02, A02B, A02BC, A02BC01), without it the top level groups are returned.
+// Products are not listed at the top level and with products=false, otherwise a page of them is returned
+// selected by the limit (default 100), offset and sort parameters.
+func (h *Handler) GetAtcGroup(c *gin.Context) {
+	code, level, err := database.ParseAtcCode(c.Query("code"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	options, _, err := listOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := AtcResponse{
+		Code:   code,
+		Level:  level,
+		Groups: h.DB.AtcGroups(code),
+	}
+
+	results := h.DB.SearchByAtc(code)
+	response.Products = len(results)
+	// All products are never listed at the top level
+	if code != "" && c.Query("products") != "false" {
+		page, total := pageResults(searchResults(results), options)
+		products := newPage(total, options, productResponse(c, page))
+		response.Page = &products
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"gorpl/internal/diff"
+	"gorpl/internal/registry"
+)
+
+// ChangeFeed compares the current data with stored snapshots
+type ChangeFeed interface {
+	ChangesSince(since time.Time) (*diff.Report, error)
+}
+
+// GetChanges handles requests for changes in the registry since a date (YYYY-MM-DD)
+// The optional type parameter limits the response to one kind of change
+func (h *Handler) GetChanges(c *gin.Context) {
+	since, err := time.ParseInLocation("2006-01-02", c.Query("since"), time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing or invalid since parameter, expected YYYY-MM-DD"})
+		return
+	}
+
+	report, err := h.Changes.ChangesSince(since)
+	if err != nil {
+		if errors.Is(err, registry.ErrSnapshotNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No snapshot available for the given date"})
+			return
+		}
+		if errors.Is(err, registry.ErrComparisonInProgress) {
+			c.Header("Retry-After", "10")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Another comparison is in progress, try again later"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if changeType := c.Query("type"); changeType != "" {
+		filtered := *report
+		filtered.Changes = []diff.Change{}
+		for _, change := range report.Changes {
+			if change.Type == changeType {
+				filtered.Changes = append(filtered.Changes, change)
+			}
+		}
+		report = &filtered
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// RegisterChangesRoutes registers the changes feed routes
+func (h *Handler) RegisterChangesRoutes(router *gin.Engine) {
+	if h.Changes == nil {
+		return
+	}
+
+	router.GET("/api/v1/changes", h.GetChanges)
+}
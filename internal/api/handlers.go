@@ -2,17 +2,25 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 
 	"gorpl/internal/database"
+	"gorpl/internal/gs1"
 	"gorpl/internal/model"
 )
 
 // Handler structure holds dependencies for API handlers
 type Handler struct {
 	DB database.ProductRepository
+	// Optional source of the changes feed
+	Changes ChangeFeed
+	// Optional dependencies of the admin API
+	Snapshots  SnapshotManager
+	Webhooks   WebhookManager
+	AdminToken string
 }
 
 // NewHandler creates a new Handler instance
@@ -32,52 +40,134 @@ func (h *Handler) GetProductByGtin(c *gin.Context) {
 	// Find the product
 	productInfo := h.DB.FindByGtin(gtin)
 	if productInfo == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		// Invalid codes are only reported when they are not in the registry as they are
+		if checkGtin(c, gtin) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		}
 		return
 	}
+	h.DB.RecordLookup(productInfo.Product.ID)
 
 	// Create a response structure to ensure proper JSON serialization
 	response := struct {
-		Product *model.ProduktLeczniczy `json:"product"`
-		Package *model.Opakowanie       `json:"package"`
+		Product  *model.ProduktLeczniczy `json:"product"`
+		Package  *model.Opakowanie       `json:"package"`
+		Packages []*model.Opakowanie     `json:"packages,omitempty"`
 	}{
 		Product: productInfo.Product,
 		Package: productInfo.Package,
 	}
+	if allPackages(c) {
+		response.Packages = database.ActivePackages(productInfo.Product)
+	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// checkGtin checks that gtin is a GTIN-8, GTIN-12, GTIN-13 or GTIN-14 with a valid check digit
+// and responds with 400 Bad Request when it is not
+func checkGtin(c *gin.Context, gtin string) bool {
+	_, err := gs1.Normalize(gtin)
+	switch {
+	case errors.Is(err, gs1.ErrInvalidCheckDigit):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid GTIN check digit"})
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid GTIN, expected 8, 12, 13 or 14 digits"})
+	}
+	return err == nil
+}
+
 // SearchProductsByName handles search requests by product name
 func (h *Handler) SearchProductsByName(c *gin.Context) {
-	// Get the query from the URL query parameters
+	// Get the query and the optional substance filter from the URL query parameters
 	query := c.Query("query")
-	if query == "" {
+	substances, err := substanceQueries(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if query == "" && len(substances) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing query parameter"})
 		return
 	}
+	options, paginated, err := listOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Search for products
-	results := h.DB.SearchByName(query)
+	var results []database.SearchResult
+	switch {
+	case query == "":
+		results = searchResults(h.DB.SearchBySubstances(substances))
+	case len(substances) == 0:
+		results = h.searchByName(c, query)
+	default:
+		results = filterResults(h.searchByName(c, query), h.DB.SearchBySubstances(substances))
+	}
 
-	// Transform results to ensure proper JSON serialization
-	var response []struct {
-		Product *model.ProduktLeczniczy `json:"product"`
-		Package *model.Opakowanie       `json:"package"`
+	if paginated {
+		page, total := pageResults(results, options)
+		c.JSON(http.StatusOK, newPage(total, options, productResponse(c, page)))
+		return
 	}
 
+	// Return results (even if empty)
+	c.JSON(http.StatusOK, productResponse(c, results))
+}
+
+// productResult is a product with its package, as returned by the search endpoints
+// Packages lists all active packages of the product when requested
+type productResult struct {
+	Product  *model.ProduktLeczniczy `json:"product"`
+	Package  *model.Opakowanie       `json:"package"`
+	Packages []*model.Opakowanie     `json:"packages,omitempty"`
+	Score    float64                 `json:"score,omitempty"`
+}
+
+// productResponse transforms search results to ensure proper JSON serialization
+// No results are an empty array, never null, e.g. when a substance filter removes all of them
+func productResponse(c *gin.Context, results []database.SearchResult) []productResult {
+	all := allPackages(c)
+
+	response := []productResult{}
 	for _, result := range results {
-		response = append(response, struct {
-			Product *model.ProduktLeczniczy `json:"product"`
-			Package *model.Opakowanie       `json:"package"`
-		}{
+		item := productResult{
 			Product: result.Product,
 			Package: result.Package,
-		})
+			Score:   result.Score,
+		}
+		if all {
+			item.Packages = database.ActivePackages(result.Product)
+		}
+		response = append(response, item)
 	}
+	return response
+}
 
-	// Return results (even if empty)
-	c.JSON(http.StatusOK, response)
+// searchResults wraps products found without scoring as search results
+func searchResults(products []*model.ProductInfo) []database.SearchResult {
+	var results []database.SearchResult
+	for _, product := range products {
+		results = append(results, database.SearchResult{ProductInfo: product})
+	}
+	return results
+}
+
+// isFuzzy reports whether typo-tolerant search was requested with fuzzy=true
+func isFuzzy(c *gin.Context) bool {
+	return c.Query("fuzzy") == "true"
+}
+
+// searchByName searches for products by name, tolerating typos when requested with fuzzy=true
+// Frequently looked up products are boosted with boost=true
+func (h *Handler) searchByName(c *gin.Context, query string) []database.SearchResult {
+	if isFuzzy(c) {
+		return h.DB.FuzzySearchByName(query)
+	}
+
+	return h.DB.RankedSearchByName(query, c.Query("boost") == "true")
 }
 
 // GetStats handles requests for database statistics
@@ -92,9 +182,31 @@ func (h *Handler) RegisterRoutes(router *gin.Engine) {
 	{
 		api.GET("/product", h.GetProductByGtin)
 		api.GET("/search", h.SearchProductsByName)
+		api.GET("/substances/search", h.SearchProductsBySubstance)
+		api.GET("/atc", h.GetAtcGroup)
+		api.GET("/query", h.QueryProducts)
+		api.GET("/suggest", h.Suggest)
 		api.GET("/stats", h.GetStats)
 	}
 
+	// API v2 Group, every package of a product is returned
+	apiV2 := router.Group("/api/v2", withAllPackages)
+	{
+		apiV2.GET("/product", h.GetProductByGtin)
+		apiV2.GET("/search", h.SearchProductsByName)
+		apiV2.GET("/substances/search", h.SearchProductsBySubstance)
+		apiV2.GET("/atc", h.GetAtcGroup)
+		apiV2.GET("/query", h.QueryProducts)
+		apiV2.GET("/suggest", h.Suggest)
+		apiV2.GET("/stats", h.GetStats)
+	}
+
 	// Register Unitbox specific routes
 	h.RegisterUnitboxRoutes(router)
+
+	// Register changes feed routes
+	h.RegisterChangesRoutes(router)
+
+	// Register admin routes
+	h.RegisterAdminRoutes(router)
 }
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"gorpl/internal/database"
+	"gorpl/internal/model"
+)
+
+// allPackagesKey marks requests which return all active packages of each product by default
+const allPackagesKey = "allPackages"
+
+// withAllPackages makes the handlers of a route group return all active packages of each product
+func withAllPackages(c *gin.Context) {
+	c.Set(allPackagesKey, true)
+	c.Next()
+}
+
+// allPackages reports whether all active packages of each product should be returned,
+// requested with packages=all or by default in the v2 API
+func allPackages(c *gin.Context) bool {
+	return c.Query("packages") == "all" || c.GetBool(allPackagesKey)
+}
+
+// expandPackages returns the product with each of its active packages, or only with its package
+// when all packages were not requested
+func expandPackages(c *gin.Context, info *model.ProductInfo) []*model.ProductInfo {
+	if !allPackages(c) {
+		return []*model.ProductInfo{info}
+	}
+
+	var expanded []*model.ProductInfo
+	for _, pkg := range database.ActivePackages(info.Product) {
+		expanded = append(expanded, &model.ProductInfo{Product: info.Product, Package: pkg})
+	}
+	return expanded
+}
+
+// expandResults returns search results with each of their active packages, like expandPackages,
+// so that pages of package listings hold the requested number of packages
+func expandResults(c *gin.Context, results []database.SearchResult) []database.SearchResult {
+	if !allPackages(c) {
+		return results
+	}
+
+	var expanded []database.SearchResult
+	for _, result := range results {
+		for _, info := range expandPackages(c, result.ProductInfo) {
+			expanded = append(expanded, database.SearchResult{ProductInfo: info, Score: result.Score})
+		}
+	}
+	return expanded
+}
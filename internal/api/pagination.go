@@ -0,0 +1,69 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"gorpl/internal/database"
+)
+
+// defaultLimit is the page size when only an offset or a sort order is given
+const defaultLimit = 100
+
+// Page is the response envelope of paginated list endpoints
+type Page[T any] struct {
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+	// Offset of the next page, missing on the last page
+	NextOffset *int `json:"nextOffset,omitempty"`
+	Results    []T  `json:"results"`
+}
+
+// listOptions parses the limit, offset and sort parameters of a request
+// paginated reports whether any of them was given, list endpoints then respond with a Page
+func listOptions(c *gin.Context) (options database.ListOptions, paginated bool, err error) {
+	limit, hasLimit := c.GetQuery("limit")
+	offset, hasOffset := c.GetQuery("offset")
+	options.Sort, paginated = c.GetQuery("sort")
+	paginated = paginated || hasLimit || hasOffset
+
+	options.Limit = defaultLimit
+	if hasLimit {
+		if options.Limit, err = strconv.Atoi(limit); err != nil || options.Limit == 0 {
+			return options, paginated, fmt.Errorf("%w: invalid limit %q", database.ErrInvalidListOptions, limit)
+		}
+	}
+	if hasOffset {
+		if options.Offset, err = strconv.Atoi(offset); err != nil {
+			return options, paginated, fmt.Errorf("%w: invalid offset %q", database.ErrInvalidListOptions, offset)
+		}
+	}
+
+	return options, paginated, options.Validate()
+}
+
+// newPage creates the envelope of a page of total results
+func newPage[T any](total int, options database.ListOptions, results []T) Page[T] {
+	page := Page[T]{
+		Total:   total,
+		Offset:  options.Offset,
+		Limit:   options.Limit,
+		Results: results,
+	}
+	if page.Results == nil {
+		page.Results = []T{}
+	}
+	if next := options.Offset + options.Limit; next < total {
+		page.NextOffset = &next
+	}
+	return page
+}
+
+// pageResults sorts search results and returns the page selected by options with the total number of results
+func pageResults(results []database.SearchResult, options database.ListOptions) ([]database.SearchResult, int) {
+	database.SortResults(results, options.Sort)
+	return database.PageResults(results, options), len(results)
+}
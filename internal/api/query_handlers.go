@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"gorpl/internal/database"
+)
+
+// QueryResponse holds the products matching a faceted query and the facet counts of each dimension
+type QueryResponse struct {
+	Page[productResult]
+	Facets map[string][]database.FacetValue `json:"facets"`
+}
+
+// QueryProducts handles faceted queries combining free text with attribute filters
+// Every dimension can be given several times to accept any of the values, e.g.
+// query=ibuprofen&kategoriaDostepnosci=OTC&drogaPodania=doustna&postac=tabletki&postac=tabletki%20powlekane
+// Results are always paginated
+func (h *Handler) QueryProducts(c *gin.Context) {
+	options, _, err := listOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := database.ProductQuery{
+		Text:    c.Query("query"),
+		Filters: make(map[string][]string),
+	}
+	for _, dimension := range database.FacetDimensions {
+		if values := c.QueryArray(dimension); len(values) > 0 {
+			query.Filters[dimension] = values
+		}
+	}
+
+	result := h.DB.Query(query)
+	page, total := pageResults(searchResults(result.Products), options)
+
+	c.JSON(http.StatusOK, QueryResponse{
+		Page:   newPage(total, options, productResponse(c, page)),
+		Facets: result.Facets,
+	})
+}
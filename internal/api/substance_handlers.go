@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"gorpl/internal/database"
+	"gorpl/internal/model"
+)
+
+// substanceQueries parses the substance parameters of a request, e.g. substance=ibuprofen%20400%20mg
+// Products have to contain all of the given substances
+func substanceQueries(c *gin.Context) ([]database.SubstanceQuery, error) {
+	var queries []database.SubstanceQuery
+	for _, text := range c.QueryArray("substance") {
+		query, err := database.ParseSubstanceQuery(text)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, query)
+	}
+	return queries, nil
+}
+
+// filterResults keeps the search results for products which are also in products
+func filterResults(results []database.SearchResult, products []*model.ProductInfo) []database.SearchResult {
+	allowed := make(map[model.BigIntAsString]bool, len(products))
+	for _, product := range products {
+		allowed[product.Product.ID] = true
+	}
+
+	var filtered []database.SearchResult
+	for _, result := range results {
+		if allowed[result.Product.ID] {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered
+}
+
+// SearchProductsBySubstance handles search requests by active substance
+// Every substance parameter is a substance name optionally followed by an amount and a unit,
+// products have to contain all of them
+func (h *Handler) SearchProductsBySubstance(c *gin.Context) {
+	queries, err := substanceQueries(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(queries) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing substance parameter"})
+		return
+	}
+	options, paginated, err := listOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := searchResults(h.DB.SearchBySubstances(queries))
+
+	if paginated {
+		page, total := pageResults(results, options)
+		c.JSON(http.StatusOK, newPage(total, options, productResponse(c, page)))
+		return
+	}
+
+	// Return results (even if empty)
+	c.JSON(http.StatusOK, productResponse(c, results))
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Number of suggestions returned by default and at most
+const (
+	defaultSuggestions = 10
+	maxSuggestions     = 100
+)
+
+// Suggest handles autocompletion requests for trade, common and substance names starting with a prefix
+func (h *Handler) Suggest(c *gin.Context) {
+	prefix := c.Query("prefix")
+	if prefix == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing prefix parameter"})
+		return
+	}
+
+	limit := defaultSuggestions
+	if text, ok := c.GetQuery("limit"); ok {
+		var err error
+		if limit, err = strconv.Atoi(text); err != nil || limit < 1 || limit > maxSuggestions {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter, expected 1 to " + strconv.Itoa(maxSuggestions)})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, h.DB.Suggest(prefix, limit))
+}
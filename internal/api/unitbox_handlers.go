@@ -6,9 +6,14 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"gorpl/internal/database"
+	"gorpl/internal/gs1"
 	"gorpl/internal/model"
 )
 
+// partialGtinScore is the score of products with a GTIN containing the query, below names containing it
+const partialGtinScore = 0.5
+
 // GetUnitboxProductByGtin handles requests for product info in unitbox format by GTIN/EAN
 func (h *Handler) GetUnitboxProductByGtin(c *gin.Context) {
 	// Get the GTIN from the URL query parameters
@@ -21,14 +26,41 @@ func (h *Handler) GetUnitboxProductByGtin(c *gin.Context) {
 	// Find the product
 	productInfo := h.DB.FindByGtin(gtin)
 	if productInfo == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		// Invalid codes are only reported when they are not in the registry as they are
+		if checkGtin(c, gtin) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		}
 		return
 	}
+	h.DB.RecordLookup(productInfo.Product.ID)
+
+	// Convert to MedicationTypeRplDto format, with all active packages when requested
+	response := unitboxProduct{MedicationTypeRplDto: model.ConvertToMedicationTypeRplDto(productInfo)}
+	if allPackages(c) {
+		for _, info := range expandPackages(c, productInfo) {
+			response.Packages = append(response.Packages, model.ConvertToMedicationTypeRplDto(info))
+		}
+	}
 
-	// Convert to MedicationTypeRplDto format
-	rplProduct := model.ConvertToMedicationTypeRplDto(productInfo)
+	c.JSON(http.StatusOK, response)
+}
 
-	c.JSON(http.StatusOK, rplProduct)
+// unitboxProduct is a medication found by GTIN, Packages lists all active packages of the product when requested
+type unitboxProduct struct {
+	*model.MedicationTypeRplDto
+	Packages []*model.MedicationTypeRplDto `json:"packages,omitempty"`
+}
+
+// scoredMedication is a medication found by a search with its relevance or similarity to the query
+type scoredMedication struct {
+	*model.MedicationTypeRplDto
+	Score float64 `json:"score"`
+}
+
+// scoredSimplifiedMedication is a simplified medication found by a search with its relevance or similarity to the query
+type scoredSimplifiedMedication struct {
+	model.SimplifiedMedicationDto
+	Score float64 `json:"score"`
 }
 
 // SearchUnitboxProductsByName handles search requests for products in unitbox format by name
@@ -40,18 +72,32 @@ func (h *Handler) SearchUnitboxProductsByName(c *gin.Context) {
 		return
 	}
 
-	// Search for products
-	results := h.DB.SearchByName(query)
+	options, paginated, err := listOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Search for products, one result per package when all packages are requested
+	results := expandResults(c, h.searchByName(c, query))
+	total := len(results)
+	if paginated {
+		results, total = pageResults(results, options)
+	}
 
 	// Convert each result to MedicationTypeRplDto format
-	var rplProducts []*model.MedicationTypeRplDto
-	for _, product := range results {
-		rplProduct := model.ConvertToMedicationTypeRplDto(product)
+	var rplProducts []scoredMedication
+	for _, result := range results {
+		rplProduct := model.ConvertToMedicationTypeRplDto(result.ProductInfo)
 		if rplProduct != nil {
-			rplProducts = append(rplProducts, rplProduct)
+			rplProducts = append(rplProducts, scoredMedication{MedicationTypeRplDto: rplProduct, Score: result.Score})
 		}
 	}
 
+	if paginated {
+		c.JSON(http.StatusOK, newPage(total, options, rplProducts))
+		return
+	}
 	c.JSON(http.StatusOK, rplProducts)
 }
 
@@ -64,62 +110,108 @@ func (h *Handler) GetSimplifiedMedications(c *gin.Context) {
 		return
 	}
 
+	options, paginated, err := listOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Search for products by name
-	resultsByName := h.DB.SearchByName(query)
+	resultsByName := h.searchByName(c, query)
 
 	// Search for products by GTIN
 	resultsByGtin := h.DB.SearchByGtin(query)
 
-	// Combine and deduplicate results
+	// Combine and deduplicate results, keeping only products with a GTIN
 	seenProducts := make(map[model.BigIntAsString]bool)
-	var allResults []*model.ProductInfo
+	var allResults []database.SearchResult
+	add := func(product database.SearchResult) {
+		if product.Product == nil || product.Package == nil || product.Package.KodGTIN == "" || seenProducts[product.Product.ID] {
+			return
+		}
+		seenProducts[product.Product.ID] = true
+		allResults = append(allResults, product)
+	}
 
 	// Add results from name search
 	for _, product := range resultsByName {
-		if !seenProducts[product.Product.ID] {
-			seenProducts[product.Product.ID] = true
-			allResults = append(allResults, product)
-		}
+		add(product)
 	}
 
-	// Add results from GTIN search
+	// Add results from GTIN search, a complete GTIN scores like an exact name and a part of one lower than a name
+	var exact *model.ProductInfo
+	if _, err := gs1.Normalize(query); err == nil {
+		exact = h.DB.FindByGtin(query)
+	}
 	for _, product := range resultsByGtin {
-		if !seenProducts[product.Product.ID] {
-			seenProducts[product.Product.ID] = true
-			allResults = append(allResults, product)
+		score := partialGtinScore
+		if exact != nil && product.Product.ID == exact.Product.ID {
+			score = 1
 		}
+		add(database.SearchResult{ProductInfo: product, Score: score})
 	}
+	database.SortResults(allResults, database.SortRelevance)
 
-	// Convert results to simplified format
-	var simplifiedResults []model.SimplifiedMedicationDto
-	for _, product := range allResults {
-		if product.Product != nil && product.Package != nil && product.Package.KodGTIN != "" {
-			simplifiedResults = append(simplifiedResults, model.SimplifiedMedicationDto{
-				TradeName: string(product.Product.NazwaProduktu),
-				EanCode:   string(product.Package.KodGTIN),
-			})
+	// One result per package with a GTIN when all packages are requested
+	var rows []database.SearchResult
+	for _, result := range expandResults(c, allResults) {
+		if result.Package.KodGTIN != "" {
+			rows = append(rows, result)
 		}
 	}
+	total := len(rows)
+	if paginated {
+		rows, total = pageResults(rows, options)
+	}
 
+	// Convert results to simplified format
+	var simplifiedResults []scoredSimplifiedMedication
+	for _, result := range rows {
+		simplifiedResults = append(simplifiedResults, scoredSimplifiedMedication{
+			SimplifiedMedicationDto: model.SimplifiedMedicationDto{
+				TradeName: string(result.Product.NazwaProduktu),
+				EanCode:   string(result.Package.KodGTIN),
+			},
+			Score: result.Score,
+		})
+	}
+
+	if paginated {
+		c.JSON(http.StatusOK, newPage(total, options, simplifiedResults))
+		return
+	}
 	c.JSON(http.StatusOK, simplifiedResults)
 }
 
 // GetAllSimplifiedMedications handles requests for all medications in simplified format
+// With limit, offset or sort parameters a page of medications is returned
+// v1 lists one medication per product and v2 one per package, so their totals differ
 func (h *Handler) GetAllSimplifiedMedications(c *gin.Context) {
-	// Get all products from the database
-	results := h.DB.GetAllProducts()
+	options, paginated, err := listOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !paginated {
+		options = database.ListOptions{}
+	}
+
+	// Products with a GTIN, one per package with a GTIN when all packages are requested
+	products, total := h.DB.ListProducts(options, allPackages(c))
 
 	// Convert results to simplified format
 	var simplifiedResults []model.SimplifiedMedicationDto
-	for _, product := range results {
-		if product.Product != nil && product.Package != nil && product.Package.KodGTIN != "" {
-			simplifiedResults = append(simplifiedResults, model.SimplifiedMedicationDto{
-				TradeName: string(product.Product.NazwaProduktu),
-				EanCode:   string(product.Package.KodGTIN),
-			})
-		}
+	for _, product := range products {
+		simplifiedResults = append(simplifiedResults, model.SimplifiedMedicationDto{
+			TradeName: string(product.Product.NazwaProduktu),
+			EanCode:   string(product.Package.KodGTIN),
+		})
 	}
 
+	if paginated {
+		c.JSON(http.StatusOK, newPage(total, options, simplifiedResults))
+		return
+	}
 	c.JSON(http.StatusOK, simplifiedResults)
 }
 
@@ -133,4 +225,13 @@ func (h *Handler) RegisterUnitboxRoutes(router *gin.Engine) {
 		apiV1.GET("/simplified", h.GetSimplifiedMedications)
 		apiV1.GET("/simplified/all", h.GetAllSimplifiedMedications)
 	}
+
+	// API v2 Group for UnitBox, every package of a product is returned
+	apiV2 := router.Group("/api/v2/unitbox", withAllPackages)
+	{
+		apiV2.GET("/product", h.GetUnitboxProductByGtin)
+		apiV2.GET("/search", h.SearchUnitboxProductsByName)
+		apiV2.GET("/simplified", h.GetSimplifiedMedications)
+		apiV2.GET("/simplified/all", h.GetAllSimplifiedMedications)
+	}
 }
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"gorpl/internal/webhook"
+)
+
+// WebhookManager keeps webhooks notified about registry changes
+type WebhookManager interface {
+	Add(hook webhook.Webhook) (*webhook.Webhook, error)
+	Remove(id string) error
+	List() []webhook.Webhook
+	Deliveries() []webhook.Delivery
+}
+
+// WebhookRequest is the body of a request to register a webhook
+type WebhookRequest struct {
+	URL       string   `json:"url" binding:"required"`
+	Secret    string   `json:"secret"`
+	GTINs     []string `json:"gtins"`
+	ATCPrefix string   `json:"atcPrefix"`
+	Types     []string `json:"types"`
+}
+
+// ListWebhooks handles requests for the registered webhooks
+func (h *Handler) ListWebhooks(c *gin.Context) {
+	c.JSON(http.StatusOK, h.Webhooks.List())
+}
+
+// AddWebhook handles requests to register a webhook
+// The response contains the secret used to sign payloads
+func (h *Handler) AddWebhook(c *gin.Context) {
+	var request WebhookRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing webhook URL"})
+		return
+	}
+
+	hook, err := h.Webhooks.Add(webhook.Webhook{
+		URL:       request.URL,
+		Secret:    request.Secret,
+		GTINs:     request.GTINs,
+		ATCPrefix: request.ATCPrefix,
+		Types:     request.Types,
+	})
+	if err != nil {
+		if errors.Is(err, webhook.ErrInvalidWebhook) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, hook)
+}
+
+// RemoveWebhook handles requests to unregister a webhook
+func (h *Handler) RemoveWebhook(c *gin.Context) {
+	if err := h.Webhooks.Remove(c.Param("id")); err != nil {
+		if errors.Is(err, webhook.ErrWebhookNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries handles requests for the webhook delivery log
+func (h *Handler) ListWebhookDeliveries(c *gin.Context) {
+	c.JSON(http.StatusOK, h.Webhooks.Deliveries())
+}
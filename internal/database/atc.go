@@ -0,0 +1,135 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gorpl/internal/model"
+)
+
+// ErrInvalidAtcCode is returned for codes which are not an ATC code or a prefix of one at a hierarchy level
+var ErrInvalidAtcCode = errors.New("invalid ATC code")
+
+// atcLevels are the lengths of ATC codes at each level of the hierarchy, e.g. A, A02, A02B, A02BC, A02BC01
+var atcLevels = []int{1, 3, 4, 5, 7}
+
+// atcPattern matches ATC codes at any level of the hierarchy
+var atcPattern = regexp.MustCompile(`^[A-Z]([0-9]{2}([A-Z]([A-Z]([0-9]{2})?)?)?)?$`)
+
+// AtcGroup is a group of the ATC hierarchy with the number of products in it
+type AtcGroup struct {
+	Code     string `json:"code"`
+	Level    int    `json:"level"`
+	Products int    `json:"products"`
+}
+
+// ParseAtcCode normalizes an ATC code and returns its level in the hierarchy, from 1 to 5
+// An empty code is the root of the hierarchy at level 0
+func ParseAtcCode(code string) (string, int, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return "", 0, nil
+	}
+	if !atcPattern.MatchString(code) {
+		return "", 0, fmt.Errorf("%w: %s", ErrInvalidAtcCode, code)
+	}
+
+	for i, length := range atcLevels {
+		if len(code) == length {
+			return code, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("%w: %s", ErrInvalidAtcCode, code)
+}
+
+// hasAtcPrefix checks whether one of the ATC codes of a product starts with prefix
+func hasAtcPrefix(product *model.ProduktLeczniczy, prefix string) bool {
+	if product.KodyATC == nil {
+		return false
+	}
+
+	for _, code := range product.KodyATC.KodATC {
+		if strings.HasPrefix(strings.ToUpper(string(code)), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchByAtc returns the products with an ATC code in the group of code, at any level of the hierarchy
+// An empty code returns all products with an ATC code
+func (db *ProductDatabase) SearchByAtc(code string) []*model.ProductInfo {
+	code, _, err := ParseAtcCode(code)
+	if err != nil {
+		return nil
+	}
+
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	if db.produkty == nil {
+		return nil
+	}
+
+	var results []*model.ProductInfo
+	for i := range db.produkty.ProduktyLecznicze {
+		product := &db.produkty.ProduktyLecznicze[i]
+		if !hasAtcPrefix(product, code) {
+			continue
+		}
+		if info := firstPackage(product); info != nil {
+			results = append(results, info)
+		}
+	}
+
+	return results
+}
+
+// AtcGroups returns the groups one level below code with the number of products in each,
+// sorted by code. Products with several codes in a group are counted once.
+func (db *ProductDatabase) AtcGroups(code string) []AtcGroup {
+	code, level, err := ParseAtcCode(code)
+	if err != nil || level >= len(atcLevels) {
+		return []AtcGroup{}
+	}
+	length := atcLevels[level]
+
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	if db.produkty == nil {
+		return []AtcGroup{}
+	}
+
+	counts := make(map[string]int)
+	for i := range db.produkty.ProduktyLecznicze {
+		product := &db.produkty.ProduktyLecznicze[i]
+		if product.KodyATC == nil || firstPackage(product) == nil {
+			continue
+		}
+
+		children := make(map[string]bool)
+		for _, atc := range product.KodyATC.KodATC {
+			atcCode := strings.ToUpper(string(atc))
+			if len(atcCode) >= length && strings.HasPrefix(atcCode, code) {
+				children[atcCode[:length]] = true
+			}
+		}
+		for child := range children {
+			counts[child]++
+		}
+	}
+
+	groups := make([]AtcGroup, 0, len(counts))
+	for child, count := range counts {
+		groups = append(groups, AtcGroup{Code: child, Level: level + 1, Products: count})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Code < groups[j].Code
+	})
+
+	return groups
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"gorpl/internal/model"
+)
+
+// cacheVersion has to be increased whenever the model or the cache layout changes
+const cacheVersion = 2
+
+// cacheHeader is written before the cached data, so that stale caches are detected without decoding them
+type cacheHeader struct {
+	Version  int
+	Checksum string
+}
+
+// cacheData is the parsed registry together with the GTIN index
+type cacheData struct {
+	Produkty *model.ProduktyLecznicze
+	// GTIN -> product and package positions
+	Gtins map[string][2]int
+}
+
+// CacheFile returns the path of the binary cache for an XML file
+func CacheFile(filename string) string {
+	return filename + ".cache"
+}
+
+// fileChecksum returns the SHA-256 checksum of a file
+func fileChecksum(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", fmt.Errorf("error opening file: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("error reading file: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// readCache loads the registry from a binary cache made for a file with the given checksum
+func readCache(filename, checksum string) (*model.ProduktyLecznicze, map[string]*model.ProductInfo, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	decoder := gob.NewDecoder(bufio.NewReaderSize(file, 1<<20))
+
+	var header cacheHeader
+	if err := decoder.Decode(&header); err != nil {
+		return nil, nil, fmt.Errorf("error decoding cache header: %w", err)
+	}
+	if header.Version != cacheVersion || header.Checksum != checksum {
+		return nil, nil, fmt.Errorf("cache is out of date")
+	}
+
+	var data cacheData
+	if err := decoder.Decode(&data); err != nil {
+		return nil, nil, fmt.Errorf("error decoding cache: %w", err)
+	}
+	if data.Produkty == nil {
+		return nil, nil, fmt.Errorf("cache is empty")
+	}
+
+	refs := make(map[string]gtinRef, len(data.Gtins))
+	for gtin, ref := range data.Gtins {
+		if ref[0] >= len(data.Produkty.ProduktyLecznicze) {
+			return nil, nil, fmt.Errorf("cache contains an invalid index entry")
+		}
+		product := &data.Produkty.ProduktyLecznicze[ref[0]]
+		if product.Opakowania == nil || ref[1] >= len(product.Opakowania.Opakowanie) {
+			return nil, nil, fmt.Errorf("cache contains an invalid index entry")
+		}
+		refs[gtin] = gtinRef{product: ref[0], pkg: ref[1]}
+	}
+
+	return data.Produkty, resolveGtinIndex(data.Produkty.ProduktyLecznicze, refs), nil
+}
+
+// writeCache stores the registry and its GTIN index in a binary cache
+func writeCache(filename, checksum string, produkty *model.ProduktyLecznicze, gtinIndex map[string]*model.ProductInfo) error {
+	// Store positions instead of pointers
+	positions := make(map[*model.Opakowanie][2]int)
+	for i := range produkty.ProduktyLecznicze {
+		product := &produkty.ProduktyLecznicze[i]
+		if product.Opakowania == nil {
+			continue
+		}
+		for j := range product.Opakowania.Opakowanie {
+			positions[&product.Opakowania.Opakowanie[j]] = [2]int{i, j}
+		}
+	}
+
+	gtins := make(map[string][2]int, len(gtinIndex))
+	for gtin, info := range gtinIndex {
+		position, ok := positions[info.Package]
+		if !ok {
+			return fmt.Errorf("index entry %s does not belong to the registry", gtin)
+		}
+		gtins[gtin] = position
+	}
+
+	tempFile := filename + ".tmp"
+	file, err := os.Create(tempFile)
+	if err != nil {
+		return fmt.Errorf("cannot create cache file: %w", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriterSize(file, 1<<20)
+	encoder := gob.NewEncoder(writer)
+
+	err = encoder.Encode(cacheHeader{Version: cacheVersion, Checksum: checksum})
+	if err == nil {
+		err = encoder.Encode(cacheData{Produkty: produkty, Gtins: gtins})
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("error writing cache: %w", err)
+	}
+
+	file.Close()
+
+	if err := os.Rename(tempFile, filename); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("cannot rename cache file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gorpl/internal/model"
+)
+
+// cacheTestXML is a registry export with a deleted package and a foreign GTIN
+const cacheTestXML = `<?xml version="1.0" encoding="UTF-8"?>
+<produktyLecznicze xmlns="http://rejestry.ezdrowie.gov.pl/rpl/eksport-danych-v6.0.0" stanNaDzien="2026-10-17">
+  <produktLeczniczy id="1" nazwaProduktu="Apap" moc="500 mg">
+    <kodyATC><kodATC>N02BE01</kodATC></kodyATC>
+    <opakowania>
+      <opakowanie id="11" kodGTIN="05909990022427" skasowane="NIE"/>
+      <opakowanie id="12" kodGTIN="05909990022434" skasowane="TAK"/>
+    </opakowania>
+  </produktLeczniczy>
+  <produktLeczniczy id="2" nazwaProduktu="Ibuprom Max">
+    <opakowania>
+      <opakowanie id="21" kodGTIN="05909990335718" skasowane="NIE">
+        <zgodyPrezesa><zgodaPrezesa><GTINZagraniczne><GTINZagraniczny numer="04030539079456"/></GTINZagraniczne></zgodaPrezesa></zgodyPrezesa>
+      </opakowanie>
+    </opakowania>
+  </produktLeczniczy>
+</produktyLecznicze>
+`
+
+// writeTestExport writes cacheTestXML to a temporary file and returns its path and checksum
+func writeTestExport(t *testing.T) (string, string) {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), "20261017_6.0.0.xml")
+	if err := os.WriteFile(filename, []byte(cacheTestXML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checksum, err := fileChecksum(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename, checksum
+}
+
+func TestCacheRoundTrip(t *testing.T) {
+	filename, checksum := writeTestExport(t)
+	produkty, gtinIndex, err := decodeFile(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cacheFile := CacheFile(filename)
+	if err := writeCache(cacheFile, checksum, produkty, gtinIndex); err != nil {
+		t.Fatal(err)
+	}
+	cached, cachedIndex, err := readCache(cacheFile, checksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(cached, produkty) {
+		t.Errorf("cached registry differs from the decoded one")
+	}
+	if len(cachedIndex) != len(gtinIndex) {
+		t.Fatalf("cached index has %d entries, want %d", len(cachedIndex), len(gtinIndex))
+	}
+	for gtin, info := range gtinIndex {
+		got := cachedIndex[gtin]
+		if got == nil || got.Product.ID != info.Product.ID || got.Package.ID != info.Package.ID {
+			t.Errorf("cached index entry %s = %+v, want package %s", gtin, got, info.Package.ID)
+			continue
+		}
+		// Entries point into the cached registry
+		if got.Product != &cached.ProduktyLecznicze[0] && got.Product != &cached.ProduktyLecznicze[1] {
+			t.Errorf("cached index entry %s does not point into the cached registry", gtin)
+		}
+	}
+}
+
+func TestReadCacheRejectsStaleCaches(t *testing.T) {
+	filename, checksum := writeTestExport(t)
+	produkty, gtinIndex, err := decodeFile(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// writeRaw writes a cache with the given header and data
+	writeRaw := func(t *testing.T, header cacheHeader, data cacheData) string {
+		cacheFile := filepath.Join(t.TempDir(), "cache")
+		file, err := os.Create(cacheFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		encoder := gob.NewEncoder(file)
+		if err := encoder.Encode(header); err != nil {
+			t.Fatal(err)
+		}
+		if err := encoder.Encode(data); err != nil {
+			t.Fatal(err)
+		}
+		return cacheFile
+	}
+
+	valid := filepath.Join(t.TempDir(), "cache")
+	if err := writeCache(valid, checksum, produkty, gtinIndex); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(t.TempDir(), "cache")
+	if err := os.WriteFile(truncated, content[:len(content)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		cacheFile string
+		checksum  string
+	}{
+		{"other checksum", valid, "other"},
+		{"older version", writeRaw(t, cacheHeader{Version: cacheVersion - 1, Checksum: checksum}, cacheData{Produkty: produkty}), checksum},
+		{"newer version", writeRaw(t, cacheHeader{Version: cacheVersion + 1, Checksum: checksum}, cacheData{Produkty: produkty}), checksum},
+		{"empty", writeRaw(t, cacheHeader{Version: cacheVersion, Checksum: checksum}, cacheData{}), checksum},
+		{"invalid index entry", writeRaw(t, cacheHeader{Version: cacheVersion, Checksum: checksum},
+			cacheData{Produkty: produkty, Gtins: map[string][2]int{"05909990022427": {0, 5}}}), checksum},
+		{"truncated", truncated, checksum},
+	}
+
+	for _, test := range tests {
+		if _, _, err := readCache(test.cacheFile, test.checksum); err == nil {
+			t.Errorf("%s: readCache succeeded, want an error", test.name)
+		}
+	}
+}
+
+func TestLoadFromFileUsesCache(t *testing.T) {
+	filename, _ := writeTestExport(t)
+
+	db := NewProductDatabase()
+	db.SetProgressFunc(nil)
+	db.SetCacheEnabled(true)
+	if err := db.LoadFromFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(CacheFile(filename)); err != nil {
+		t.Fatalf("cache was not written: %v", err)
+	}
+
+	// A cache of other content is ignored and replaced
+	stale := &model.ProduktyLecznicze{StanNaDzien: "2020-01-01"}
+	if err := writeCache(CacheFile(filename), "other", stale, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	cached := NewProductDatabase()
+	cached.SetProgressFunc(nil)
+	cached.SetCacheEnabled(true)
+	if err := cached.LoadFromFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cached.Summary(), db.Summary(); got != want {
+		t.Errorf("summary after ignoring the stale cache = %+v, want %+v", got, want)
+	}
+	if info := cached.FindByGtin("5909990022427"); info == nil || info.Package.ID != "11" {
+		t.Errorf("FindByGtin = %+v, want package 11", info)
+	}
+
+	// The rewritten cache is used
+	checksum, _ := fileChecksum(filename)
+	if _, _, err := readCache(CacheFile(filename), checksum); err != nil {
+		t.Errorf("cache was not rewritten: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gorpl/internal/model"
+)
+
+// ProductChange identifies a product changed by an incremental export
+type ProductChange struct {
+	ID            string `json:"id"`
+	NazwaProduktu string `json:"nazwaProduktu"`
+}
+
+// ChangeSet describes the changes applied from an incremental export
+type ChangeSet struct {
+	SourceFile  string          `json:"sourceFile"`
+	StanNaDzien string          `json:"stanNaDzien"`
+	AppliedAt   time.Time       `json:"appliedAt"`
+	Added       []ProductChange `json:"added"`
+	Modified    []ProductChange `json:"modified"`
+	Deleted     []ProductChange `json:"deleted"`
+	// Deleted products which were not in the dataset
+	Skipped []ProductChange `json:"skipped"`
+}
+
+// LoadDeltaFromFile applies an incremental export on top of the data of base and loads the result
+// Products with status Nowy or Zmodyfikowany replace products with the same ID or are added,
+// products with status Usuniety are removed. The base database is not modified.
+func (db *ProductDatabase) LoadDeltaFromFile(base *ProductDatabase, filename string) (*ChangeSet, error) {
+	checksum, err := fileChecksum(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	delta, _, err := decodeFile(filename, db.progress)
+	if err != nil {
+		return nil, err
+	}
+
+	base.mutex.RLock()
+	current := base.produkty
+	base.mutex.RUnlock()
+	if current == nil {
+		return nil, fmt.Errorf("no data to apply the incremental export to")
+	}
+
+	produkty, changes := applyDelta(current, delta)
+	changes.SourceFile = filename
+
+	refs := make(map[string]gtinRef)
+	for i := range produkty.ProduktyLecznicze {
+		collectGtins(refs, &produkty.ProduktyLecznicze[i], i)
+	}
+	gtinIndex := resolveGtinIndex(produkty.ProduktyLecznicze, refs)
+	textIndex := buildTextIndex(produkty.ProduktyLecznicze)
+
+	log.Printf("Applied %s: %d added, %d modified, %d deleted, %d skipped",
+		filename, len(changes.Added), len(changes.Modified), len(changes.Deleted), len(changes.Skipped))
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.produkty = produkty
+	db.gtinIndex = gtinIndex
+	db.textIndex = textIndex
+	db.listings = nil
+	db.sourceFile = filename
+	db.checksum = checksum
+	db.stale = false
+
+	return changes, nil
+}
+
+// applyDelta merges the products of an incremental export into a copy of the current products
+func applyDelta(current, delta *model.ProduktyLecznicze) (*model.ProduktyLecznicze, *ChangeSet) {
+	changes := &ChangeSet{
+		StanNaDzien: string(delta.StanNaDzien),
+		AppliedAt:   time.Now(),
+		Added:       []ProductChange{},
+		Modified:    []ProductChange{},
+		Deleted:     []ProductChange{},
+		Skipped:     []ProductChange{},
+	}
+
+	positions := make(map[model.BigIntAsString]int, len(current.ProduktyLecznicze))
+	for i := range current.ProduktyLecznicze {
+		positions[current.ProduktyLecznicze[i].ID] = i
+	}
+
+	// Products are copied by value, their contents are shared with the current data and never modified
+	products := make([]model.ProduktLeczniczy, len(current.ProduktyLecznicze))
+	copy(products, current.ProduktyLecznicze)
+	deleted := make(map[int]bool)
+
+	for _, product := range delta.ProduktyLecznicze {
+		change := ProductChange{ID: string(product.ID), NazwaProduktu: string(product.NazwaProduktu)}
+		i, exists := positions[product.ID]
+
+		switch {
+		case product.Status == model.StatusUsuniety && exists && !deleted[i]:
+			deleted[i] = true
+			changes.Deleted = append(changes.Deleted, change)
+		case product.Status == model.StatusUsuniety:
+			changes.Skipped = append(changes.Skipped, change)
+		case exists && !deleted[i]:
+			products[i] = product
+			changes.Modified = append(changes.Modified, change)
+		default:
+			positions[product.ID] = len(products)
+			products = append(products, product)
+			changes.Added = append(changes.Added, change)
+		}
+	}
+
+	merged := &model.ProduktyLecznicze{
+		XMLName:           current.XMLName,
+		StanNaDzien:       current.StanNaDzien,
+		ProduktyLecznicze: make([]model.ProduktLeczniczy, 0, len(products)-len(deleted)),
+	}
+	if delta.StanNaDzien != "" {
+		merged.StanNaDzien = delta.StanNaDzien
+	}
+	for i, product := range products {
+		if !deleted[i] {
+			merged.ProduktyLecznicze = append(merged.ProduktyLecznicze, product)
+		}
+	}
+
+	return merged, changes
+}
@@ -0,0 +1,198 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gorpl/internal/model"
+)
+
+// deltaProduct creates a product of an incremental export
+func deltaProduct(id, name string, status model.ChangeTypeString) model.ProduktLeczniczy {
+	return model.ProduktLeczniczy{ID: model.BigIntAsString(id), NazwaProduktu: model.LimitedString(name), Status: status}
+}
+
+// productIDs returns the IDs and names of products in order
+func productIDs(products []model.ProduktLeczniczy) string {
+	var ids []string
+	for _, product := range products {
+		ids = append(ids, string(product.ID)+":"+string(product.NazwaProduktu))
+	}
+	return strings.Join(ids, " ")
+}
+
+// changeIDs returns the IDs of changed products in order
+func changeIDs(changes []ProductChange) string {
+	var ids []string
+	for _, change := range changes {
+		ids = append(ids, change.ID)
+	}
+	return strings.Join(ids, " ")
+}
+
+func TestApplyDelta(t *testing.T) {
+	tests := []struct {
+		name  string
+		delta []model.ProduktLeczniczy
+		// Resulting products and the IDs of added, modified, deleted and skipped products
+		want     string
+		added    string
+		modified string
+		deleted  string
+		skipped  string
+	}{
+		{
+			name: "no changes",
+			want: "1:Apap 2:Ibuprom 3:Nurofen",
+		},
+		{
+			name:  "new product",
+			delta: []model.ProduktLeczniczy{deltaProduct("4", "Polopiryna", model.StatusNowy)},
+			want:  "1:Apap 2:Ibuprom 3:Nurofen 4:Polopiryna",
+			added: "4",
+		},
+		{
+			name:     "modified product keeps its place",
+			delta:    []model.ProduktLeczniczy{deltaProduct("2", "Ibuprom Max", model.StatusZmodyfikowany)},
+			want:     "1:Apap 2:Ibuprom Max 3:Nurofen",
+			modified: "2",
+		},
+		{
+			name:  "modification of a missing product adds it",
+			delta: []model.ProduktLeczniczy{deltaProduct("5", "Etopiryna", model.StatusZmodyfikowany)},
+			want:  "1:Apap 2:Ibuprom 3:Nurofen 5:Etopiryna",
+			added: "5",
+		},
+		{
+			name:    "deleted product",
+			delta:   []model.ProduktLeczniczy{deltaProduct("2", "Ibuprom", model.StatusUsuniety)},
+			want:    "1:Apap 3:Nurofen",
+			deleted: "2",
+		},
+		{
+			name:    "deletion of a missing product is skipped",
+			delta:   []model.ProduktLeczniczy{deltaProduct("9", "Nieznany", model.StatusUsuniety)},
+			want:    "1:Apap 2:Ibuprom 3:Nurofen",
+			skipped: "9",
+		},
+		{
+			name: "product deleted twice",
+			delta: []model.ProduktLeczniczy{
+				deltaProduct("1", "Apap", model.StatusUsuniety),
+				deltaProduct("1", "Apap", model.StatusUsuniety),
+			},
+			want:    "2:Ibuprom 3:Nurofen",
+			deleted: "1",
+			skipped: "1",
+		},
+		{
+			name: "product deleted and added again",
+			delta: []model.ProduktLeczniczy{
+				deltaProduct("3", "Nurofen", model.StatusUsuniety),
+				deltaProduct("3", "Nurofen Forte", model.StatusNowy),
+			},
+			want:    "1:Apap 2:Ibuprom 3:Nurofen Forte",
+			added:   "3",
+			deleted: "3",
+		},
+		{
+			name: "every kind of change",
+			delta: []model.ProduktLeczniczy{
+				deltaProduct("1", "Apap Extra", model.StatusZmodyfikowany),
+				deltaProduct("2", "Ibuprom", model.StatusUsuniety),
+				deltaProduct("4", "Polopiryna", model.StatusNowy),
+			},
+			want:     "1:Apap Extra 3:Nurofen 4:Polopiryna",
+			added:    "4",
+			modified: "1",
+			deleted:  "2",
+		},
+	}
+
+	for _, test := range tests {
+		current := &model.ProduktyLecznicze{
+			StanNaDzien: "2026-10-16",
+			ProduktyLecznicze: []model.ProduktLeczniczy{
+				deltaProduct("1", "Apap", ""),
+				deltaProduct("2", "Ibuprom", ""),
+				deltaProduct("3", "Nurofen", ""),
+			},
+		}
+		delta := &model.ProduktyLecznicze{StanNaDzien: "2026-10-17", ProduktyLecznicze: test.delta}
+
+		merged, changes := applyDelta(current, delta)
+
+		if got := productIDs(merged.ProduktyLecznicze); got != test.want {
+			t.Errorf("%s: products = %q, want %q", test.name, got, test.want)
+		}
+		if merged.StanNaDzien != "2026-10-17" {
+			t.Errorf("%s: stanNaDzien = %q, want the date of the export", test.name, merged.StanNaDzien)
+		}
+		for kind, got := range map[string][2]string{
+			"added":    {changeIDs(changes.Added), test.added},
+			"modified": {changeIDs(changes.Modified), test.modified},
+			"deleted":  {changeIDs(changes.Deleted), test.deleted},
+			"skipped":  {changeIDs(changes.Skipped), test.skipped},
+		} {
+			if got[0] != got[1] {
+				t.Errorf("%s: %s = %q, want %q", test.name, kind, got[0], got[1])
+			}
+		}
+		// The current data is never modified
+		if got := productIDs(current.ProduktyLecznicze); got != "1:Apap 2:Ibuprom 3:Nurofen" {
+			t.Errorf("%s: current products changed to %q", test.name, got)
+		}
+	}
+}
+
+func TestLoadDeltaFromFile(t *testing.T) {
+	filename, _ := writeTestExport(t)
+	base := NewProductDatabase()
+	base.SetProgressFunc(nil)
+	if err := base.LoadFromFile(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	deltaFile := filepath.Join(t.TempDir(), "delta.xml")
+	delta := `<?xml version="1.0" encoding="UTF-8"?>
+<produktyLecznicze xmlns="http://rejestry.ezdrowie.gov.pl/rpl/eksport-danych-v6.0.0" stanNaDzien="2026-10-18">
+  <produktLeczniczy id="1" nazwaProduktu="Apap" status="Usuniety"/>
+  <produktLeczniczy id="3" nazwaProduktu="Polopiryna" status="Nowy">
+    <opakowania><opakowanie id="31" kodGTIN="05909990110831" skasowane="NIE"/></opakowania>
+  </produktLeczniczy>
+</produktyLecznicze>
+`
+	if err := os.WriteFile(deltaFile, []byte(delta), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	next := base.NewEmpty()
+	changes, err := next.LoadDeltaFromFile(base, deltaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changeIDs(changes.Deleted) != "1" || changeIDs(changes.Added) != "3" || changes.SourceFile != deltaFile {
+		t.Errorf("changes = %+v, want product 1 deleted and 3 added", changes)
+	}
+
+	// The deleted product is gone from every index
+	if info := next.FindByGtin("05909990022427"); info != nil {
+		t.Errorf("GTIN of the deleted product still finds %s", info.Product.NazwaProduktu)
+	}
+	if results := next.SearchByName("apap"); len(results) != 0 {
+		t.Errorf("name of the deleted product still finds %d products", len(results))
+	}
+	if info := next.FindByGtin("05909990110831"); info == nil || info.Product.ID != "3" {
+		t.Errorf("GTIN of the added product finds %+v, want product 3", info)
+	}
+	if summary := next.Summary(); summary.Products != 2 || summary.StanNaDzien != "2026-10-18" {
+		t.Errorf("summary = %+v, want 2 products from 2026-10-18", summary)
+	}
+
+	// The base database is not modified
+	if info := base.FindByGtin("05909990022427"); info == nil {
+		t.Errorf("base database lost the deleted product")
+	}
+}
@@ -2,14 +2,15 @@
 package database
 
 import (
-	"encoding/xml"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
 
+	"gorpl/internal/gs1"
 	"gorpl/internal/model"
 )
 
@@ -18,9 +19,18 @@ type ProductRepository interface {
 	LoadFromFile(filename string) error
 	FindByGtin(gtin string) *model.ProductInfo
 	SearchByName(query string) []*model.ProductInfo
+	RankedSearchByName(query string, boost bool) []SearchResult
+	RecordLookup(id model.BigIntAsString)
+	Suggest(prefix string, limit int) []Suggestion
+	FuzzySearchByName(query string) []SearchResult
+	SearchBySubstances(queries []SubstanceQuery) []*model.ProductInfo
+	SearchByAtc(code string) []*model.ProductInfo
+	AtcGroups(code string) []AtcGroup
+	Query(query ProductQuery) *QueryResult
 	SearchByGtin(gtin string) []*model.ProductInfo
 	GetStatistics() map[string]interface{}
 	GetAllProducts() []*model.ProductInfo
+	ListProducts(options ListOptions, allPackages bool) ([]*model.ProductInfo, int)
 }
 
 // ProductDatabase holds the database of medical products and provides methods to search it
@@ -28,7 +38,20 @@ type ProductDatabase struct {
 	produkty *model.ProduktyLecznicze
 	// Map for quick lookups by GTIN (EAN)
 	gtinIndex map[string]*model.ProductInfo
-	mutex     sync.RWMutex
+	// Inverted index of product and substance names
+	textIndex *textIndex
+	// Lookups of products, kept when the data is replaced
+	lookups popularity
+	// File the data was loaded from and whether it is known to be out of date
+	sourceFile string
+	checksum   string
+	stale      bool
+	progress   ProgressFunc
+	cache      bool
+	mutex      sync.RWMutex
+	// Sorted listings of all products, built on first use and dropped when the data is replaced
+	listings      map[listingKey][]*model.ProductInfo
+	listingsMutex sync.Mutex
 }
 
 // Make sure ProductDatabase implements ProductRepository
@@ -38,85 +61,183 @@ var _ ProductRepository = (*ProductDatabase)(nil)
 func NewProductDatabase() *ProductDatabase {
 	return &ProductDatabase{
 		gtinIndex: make(map[string]*model.ProductInfo),
+		progress:  logProgress,
 	}
 }
 
-// LoadFromFile loads the products from an XML file
+// LoadFromFile loads the products from an XML file, optionally gzip compressed (.xml.gz)
+// The file is decoded outside of the lock, so requests are served from the old data while loading
+// When caching is enabled, a binary cache of the file is used if its checksum matches
 func (db *ProductDatabase) LoadFromFile(filename string) error {
+	checksum, err := fileChecksum(filename)
+	if err != nil {
+		return err
+	}
+
+	var produkty *model.ProduktyLecznicze
+	var gtinIndex map[string]*model.ProductInfo
+
+	cacheFile := CacheFile(filename)
+	if db.cache {
+		produkty, gtinIndex, err = readCache(cacheFile, checksum)
+		if err == nil {
+			log.Printf("Loaded products from cache %s", cacheFile)
+		} else if !os.IsNotExist(err) {
+			log.Printf("Ignoring cache %s: %v", cacheFile, err)
+		}
+	}
+
+	if produkty == nil {
+		produkty, gtinIndex, err = decodeFile(filename, db.progress)
+		if err != nil {
+			return err
+		}
+
+		if db.cache {
+			if err := writeCache(cacheFile, checksum, produkty, gtinIndex); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}
+	}
+
+	log.Printf("Built GTIN index with %d entries", len(gtinIndex))
+	textIndex := buildTextIndex(produkty.ProduktyLecznicze)
+
 	db.mutex.Lock()
 	defer db.mutex.Unlock()
 
+	db.produkty = produkty
+	db.gtinIndex = gtinIndex
+	db.textIndex = textIndex
+	db.listings = nil
+	db.sourceFile = filename
+	db.checksum = checksum
+	db.stale = false
+
+	return nil
+}
+
+// decodeFile decodes products from an XML file, optionally gzip compressed (.xml.gz)
+func decodeFile(filename string, progress ProgressFunc) (*model.ProduktyLecznicze, map[string]*model.ProductInfo, error) {
 	file, err := os.Open(filename)
 	if err != nil {
-		return fmt.Errorf("error opening file: %w", err)
+		return nil, nil, fmt.Errorf("error opening file: %w", err)
 	}
 	defer file.Close()
 
-	decoder := xml.NewDecoder(file)
-	var produkty model.ProduktyLecznicze
-
-	err = decoder.Decode(&produkty)
-	if err != nil {
-		return fmt.Errorf("error decoding XML: %w", err)
+	var totalBytes int64
+	if info, err := file.Stat(); err == nil {
+		totalBytes = info.Size()
 	}
 
-	db.produkty = &produkty
-	db.buildGtinIndex()
+	return decodeProducts(file, totalBytes, strings.HasSuffix(filename, ".gz"), progress)
+}
 
-	return nil
+// SetCacheEnabled enables or disables the binary cache written next to loaded files
+func (db *ProductDatabase) SetCacheEnabled(enabled bool) {
+	db.cache = enabled
 }
 
-// buildGtinIndex creates an index of products by GTIN for fast lookups
-func (db *ProductDatabase) buildGtinIndex() {
-	db.gtinIndex = make(map[string]*model.ProductInfo)
+// NewEmpty creates a new, empty database with the same settings
+func (db *ProductDatabase) NewEmpty() *ProductDatabase {
+	next := NewProductDatabase()
+	next.progress = db.progress
+	next.cache = db.cache
+	return next
+}
 
-	for i := range db.produkty.ProduktyLecznicze {
-		product := &db.produkty.ProduktyLecznicze[i]
+// SetProgressFunc sets the function called periodically while loading files
+// Progress is written to the log by default, nil disables reporting
+func (db *ProductDatabase) SetProgressFunc(progress ProgressFunc) {
+	db.progress = progress
+}
 
-		if product.Opakowania == nil {
-			continue
-		}
+// ReplaceWith swaps the contents of the database for the contents of another, already loaded database
+// Requests in progress keep using the old data, new requests see the new data
+func (db *ProductDatabase) ReplaceWith(other *ProductDatabase) {
+	other.mutex.RLock()
+	produkty, gtinIndex, textIndex := other.produkty, other.gtinIndex, other.textIndex
+	sourceFile, checksum, stale := other.sourceFile, other.checksum, other.stale
+	other.mutex.RUnlock()
 
-		for j := range product.Opakowania.Opakowanie {
-			pkg := &product.Opakowania.Opakowanie[j]
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
 
-			if pkg.Skasowane == "TAK" {
-				continue
-			}
+	db.produkty = produkty
+	db.gtinIndex = gtinIndex
+	db.textIndex = textIndex
+	db.listings = nil
+	db.sourceFile = sourceFile
+	db.checksum = checksum
+	db.stale = stale
+}
 
-			if pkg.KodGTIN != "" {
-				db.gtinIndex[string(pkg.KodGTIN)] = &model.ProductInfo{
-					Product: product,
-					Package: pkg,
-				}
-			}
+// SetSourceFile records that the file the data was loaded from was moved to filename
+func (db *ProductDatabase) SetSourceFile(filename string) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
 
-			if pkg.ZgodyPrezesa != nil {
-				for _, zgoda := range pkg.ZgodyPrezesa.ZgodaPrezesa {
-					if zgoda.GTINZagraniczne != nil {
-						for _, gtin := range zgoda.GTINZagraniczne.GTINZagraniczny {
-							if gtin.Numer != "" {
-								db.gtinIndex[gtin.Numer] = &model.ProductInfo{
-									Product: product,
-									Package: pkg,
-								}
-							}
-						}
-					}
-				}
-			}
-		}
-	}
+	db.sourceFile = filename
+}
 
-	log.Printf("Built GTIN index with %d entries", len(db.gtinIndex))
+// SetStale marks the data as out of date, e.g. when a newer registry export could not be downloaded
+func (db *ProductDatabase) SetStale(stale bool) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.stale = stale
 }
 
 // FindByGtin finds a product by its GTIN/EAN code
+// GTIN-8, GTIN-12, GTIN-13 and GTIN-14 forms of the same code find the same product
 func (db *ProductDatabase) FindByGtin(gtin string) *model.ProductInfo {
 	db.mutex.RLock()
 	defer db.mutex.RUnlock()
 
-	return db.gtinIndex[gtin]
+	return db.gtinIndex[gs1.Key(gtin)]
+}
+
+// Produkty returns the loaded registry, it must not be modified
+func (db *ProductDatabase) Produkty() *model.ProduktyLecznicze {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	return db.produkty
+}
+
+// IsStale reports whether the data is known to be out of date
+func (db *ProductDatabase) IsStale() bool {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	return db.stale
+}
+
+// Summary describes the data held by the database
+type Summary struct {
+	StanNaDzien string
+	Products    int
+	GtinEntries int
+	SourceFile  string
+	Checksum    string
+}
+
+// Summary returns a summary of the data held by the database
+func (db *ProductDatabase) Summary() Summary {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	if db.produkty == nil {
+		return Summary{}
+	}
+
+	return Summary{
+		StanNaDzien: string(db.produkty.StanNaDzien),
+		Products:    len(db.produkty.ProduktyLecznicze),
+		GtinEntries: len(db.gtinIndex),
+		SourceFile:  db.sourceFile,
+		Checksum:    db.checksum,
+	}
 }
 
 // GetStatistics returns statistics about the database
@@ -128,50 +249,63 @@ func (db *ProductDatabase) GetStatistics() map[string]interface{} {
 		"stanNaDzien":       db.produkty.StanNaDzien,
 		"liczbaProdukow":    len(db.produkty.ProduktyLecznicze),
 		"liczbaIndeksowEAN": len(db.gtinIndex),
+		"plikZrodlowy":      filepath.Base(db.sourceFile),
+		"daneNieaktualne":   db.stale,
 	}
 }
 
-// SearchByName searches for products by name (partial match)
+// SearchByName searches for products by trade, common, previous and active substance names
+// Every word of the query has to be a prefix of a word in one of the names, in any order
+// Results are sorted by relevance, best first
 func (db *ProductDatabase) SearchByName(query string) []*model.ProductInfo {
+	var results []*model.ProductInfo
+	for _, result := range db.RankedSearchByName(query, false) {
+		results = append(results, result.ProductInfo)
+	}
+
+	return results
+}
+
+// SearchResult is a product found by a search with its relevance or similarity to the query, from 0 to 1
+type SearchResult struct {
+	*model.ProductInfo
+	Score float64
+}
+
+// FuzzySearchByName searches for products like SearchByName, but tolerates typos in the query
+// Results are sorted by similarity, best matches first
+func (db *ProductDatabase) FuzzySearchByName(query string) []SearchResult {
 	db.mutex.RLock()
 	defer db.mutex.RUnlock()
 
-	if query == "" {
+	if query == "" || db.textIndex == nil {
 		return nil
 	}
 
-	var results []*model.ProductInfo
-	seenProducts := make(map[model.BigIntAsString]bool)
-
-	for i := range db.produkty.ProduktyLecznicze {
-		product := &db.produkty.ProduktyLecznicze[i]
-
-		if seenProducts[product.ID] {
-			continue
+	var results []SearchResult
+	for _, match := range db.textIndex.fuzzySearch(query) {
+		product := &db.produkty.ProduktyLecznicze[match.position]
+		if info := firstPackage(product); info != nil {
+			results = append(results, SearchResult{ProductInfo: info, Score: match.score})
 		}
+	}
 
-		if containsIgnoreCase(string(product.NazwaProduktu), query) ||
-			containsIgnoreCase(string(product.NazwaPowszechnieStosowana), query) {
-
-			seenProducts[product.ID] = true
+	return results
+}
 
-			if product.Opakowania != nil {
-				for j := range product.Opakowania.Opakowanie {
-					pkg := &product.Opakowania.Opakowanie[j]
+// firstPackage returns the product with its first non-deleted package, nil when there is none
+func firstPackage(product *model.ProduktLeczniczy) *model.ProductInfo {
+	if product.Opakowania == nil {
+		return nil
+	}
 
-					if pkg.Skasowane != "TAK" {
-						results = append(results, &model.ProductInfo{
-							Product: product,
-							Package: pkg,
-						})
-						break
-					}
-				}
-			}
+	for j := range product.Opakowania.Opakowanie {
+		pkg := &product.Opakowania.Opakowanie[j]
+		if pkg.Skasowane != "TAK" {
+			return &model.ProductInfo{Product: product, Package: pkg}
 		}
 	}
-
-	return results
+	return nil
 }
 
 // containsIgnoreCase checks if a string contains another string (case-insensitive)
@@ -207,6 +341,11 @@ func (db *ProductDatabase) GetAllProducts() []*model.ProductInfo {
 	db.mutex.RLock()
 	defer db.mutex.RUnlock()
 
+	return db.allProducts()
+}
+
+// allProducts returns each product with its first non-deleted package, the caller has to hold the lock
+func (db *ProductDatabase) allProducts() []*model.ProductInfo {
 	var results []*model.ProductInfo
 	seenProducts := make(map[model.BigIntAsString]bool)
 
@@ -219,18 +358,8 @@ func (db *ProductDatabase) GetAllProducts() []*model.ProductInfo {
 
 		seenProducts[product.ID] = true
 
-		if product.Opakowania != nil {
-			for j := range product.Opakowania.Opakowanie {
-				pkg := &product.Opakowania.Opakowanie[j]
-
-				if pkg.Skasowane != "TAK" {
-					results = append(results, &model.ProductInfo{
-						Product: product,
-						Package: pkg,
-					})
-					break
-				}
-			}
+		if info := firstPackage(product); info != nil {
+			results = append(results, info)
 		}
 	}
 
@@ -249,6 +378,14 @@ func (db *ProductDatabase) SearchByGtin(gtin string) []*model.ProductInfo {
 	var results []*model.ProductInfo
 	seenProducts := make(map[model.BigIntAsString]bool)
 
+	// A complete GTIN matches in any of its formats, e.g. with or without leading zeros
+	if key, err := gs1.Normalize(gtin); err == nil {
+		if info := db.gtinIndex[key]; info != nil {
+			seenProducts[info.Product.ID] = true
+			results = append(results, info)
+		}
+	}
+
 	// Search through all products
 	for i := range db.produkty.ProduktyLecznicze {
 		product := &db.produkty.ProduktyLecznicze[i]
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"gorpl/internal/gs1"
+	"gorpl/internal/model"
+)
+
+// Sort orders of list results
+const (
+	// SortRelevance sorts by score, best matches first
+	SortRelevance = "relevance"
+	SortName      = "name"
+	SortStrength  = "strength"
+	SortGtin      = "gtin"
+)
+
+// MaxLimit is the largest number of results returned in one page
+const MaxLimit = 1000
+
+// ErrInvalidListOptions is returned for unknown sort orders and out of range offsets or limits
+var ErrInvalidListOptions = errors.New("invalid list options")
+
+// ListOptions selects a page of sorted results
+type ListOptions struct {
+	// One of the Sort constants, empty is SortRelevance
+	Sort   string
+	Offset int
+	// Number of results in the page, 0 returns all results from the offset
+	Limit int
+}
+
+// Validate checks the sort order and the range of the offset and limit
+func (o ListOptions) Validate() error {
+	switch o.Sort {
+	case "", SortRelevance, SortName, SortStrength, SortGtin:
+	default:
+		return fmt.Errorf("%w: unknown sort %q", ErrInvalidListOptions, o.Sort)
+	}
+	if o.Offset < 0 {
+		return fmt.Errorf("%w: negative offset", ErrInvalidListOptions)
+	}
+	if o.Limit < 0 || o.Limit > MaxLimit {
+		return fmt.Errorf("%w: limit has to be at most %d", ErrInvalidListOptions, MaxLimit)
+	}
+	return nil
+}
+
+// strengthValue returns the leading number of a strength like "500 mg" or "0,5 mg/ml"
+// Strengths without a number are sorted last
+func strengthValue(moc string) float64 {
+	number, _ := splitAmount(strings.TrimSpace(moc))
+	value, err := parseAmount(number)
+	if err != nil {
+		return math.Inf(1)
+	}
+	return value
+}
+
+// SortResults sorts search results in the given order, results with equal keys keep their order
+func SortResults(results []SearchResult, sortBy string) {
+	switch sortBy {
+	case "", SortRelevance:
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].Score > results[j].Score
+		})
+	case SortName:
+		keys := make(map[*model.ProduktLeczniczy]string, len(results))
+		for _, result := range results {
+			keys[result.Product] = foldDiacritics(string(result.Product.NazwaProduktu))
+		}
+		sort.SliceStable(results, func(i, j int) bool {
+			return keys[results[i].Product] < keys[results[j].Product]
+		})
+	case SortStrength:
+		keys := make(map[*model.ProduktLeczniczy]float64, len(results))
+		for _, result := range results {
+			keys[result.Product] = strengthValue(result.Product.Moc)
+		}
+		sort.SliceStable(results, func(i, j int) bool {
+			return keys[results[i].Product] < keys[results[j].Product]
+		})
+	case SortGtin:
+		// GTINs are compared in their 14 digit form, so that GTIN-13 and padded GTIN-14 codes sort together
+		keys := make(map[*model.Opakowanie]string, len(results))
+		for _, result := range results {
+			keys[result.Package] = gs1.Key(string(result.Package.KodGTIN))
+		}
+		sort.SliceStable(results, func(i, j int) bool {
+			return keys[results[i].Package] < keys[results[j].Package]
+		})
+	}
+}
+
+// PageResults returns the page of results selected by the offset and limit of options
+func PageResults[T any](results []T, options ListOptions) []T {
+	if options.Offset >= len(results) {
+		return results[:0]
+	}
+	results = results[options.Offset:]
+	if options.Limit > 0 && options.Limit < len(results) {
+		results = results[:options.Limit]
+	}
+	return results
+}
+
+// listingKey identifies a sorted listing of all products
+type listingKey struct {
+	sort        string
+	allPackages bool
+}
+
+// ListProducts returns the page of products with a GTIN selected by options and the total number of them
+// Each product is listed with its first active package, with allPackages every active package with a GTIN is listed.
+// The relevance order is the order of the registry. The returned products must not be modified.
+func (db *ProductDatabase) ListProducts(options ListOptions, allPackages bool) ([]*model.ProductInfo, int) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	listing := db.listing(listingKey{sort: options.Sort, allPackages: allPackages})
+	return PageResults(listing, options), len(listing)
+}
+
+// listing returns a sorted listing of all products, building it on first use
+// The caller has to hold the read lock, so that the data is not replaced meanwhile
+func (db *ProductDatabase) listing(key listingKey) []*model.ProductInfo {
+	if key.sort == "" {
+		key.sort = SortRelevance
+	}
+
+	db.listingsMutex.Lock()
+	defer db.listingsMutex.Unlock()
+
+	if listing, ok := db.listings[key]; ok {
+		return listing
+	}
+
+	var results []SearchResult
+	for _, info := range db.allProducts() {
+		if !key.allPackages {
+			if info.Package.KodGTIN != "" {
+				results = append(results, SearchResult{ProductInfo: info})
+			}
+			continue
+		}
+		for _, pkg := range ActivePackages(info.Product) {
+			if pkg.KodGTIN != "" {
+				results = append(results, SearchResult{ProductInfo: &model.ProductInfo{Product: info.Product, Package: pkg}})
+			}
+		}
+	}
+	SortResults(results, key.sort)
+
+	listing := make([]*model.ProductInfo, len(results))
+	for i, result := range results {
+		listing[i] = result.ProductInfo
+	}
+
+	if db.listings == nil {
+		db.listings = make(map[listingKey][]*model.ProductInfo)
+	}
+	db.listings[key] = listing
+	return listing
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"strconv"
+	"testing"
+
+	"gorpl/internal/model"
+)
+
+// listDatabase creates a database of products with packages having the given GTINs
+func listDatabase(products map[string][]string, order ...string) *ProductDatabase {
+	var produkty []model.ProduktLeczniczy
+	for i, name := range order {
+		product := model.ProduktLeczniczy{
+			ID:            model.BigIntAsString(strconv.Itoa(i + 1)),
+			NazwaProduktu: model.LimitedString(name),
+			Opakowania:    &model.Opakowania{},
+		}
+		for _, gtin := range products[name] {
+			product.Opakowania.Opakowanie = append(product.Opakowania.Opakowanie, model.Opakowanie{KodGTIN: model.LimitedString(gtin)})
+		}
+		produkty = append(produkty, product)
+	}
+	return rankingDatabase(produkty...)
+}
+
+func TestListProducts(t *testing.T) {
+	db := listDatabase(map[string][]string{
+		"Zyrtec":  {"5909990022458", "05909990022427"},
+		"Apap":    {"05909990022434"},
+		"No GTIN": {""},
+	}, "Zyrtec", "Apap", "No GTIN")
+
+	tests := []struct {
+		name        string
+		options     ListOptions
+		allPackages bool
+		want        []string
+		total       int
+	}{
+		{"registry order", ListOptions{}, false, []string{"5909990022458", "05909990022434"}, 2},
+		{"all packages", ListOptions{}, true, []string{"5909990022458", "05909990022427", "05909990022434"}, 3},
+		{"by GTIN", ListOptions{Sort: SortGtin}, true, []string{"05909990022427", "05909990022434", "5909990022458"}, 3},
+		{"by name", ListOptions{Sort: SortName}, false, []string{"05909990022434", "5909990022458"}, 2},
+		{"page", ListOptions{Sort: SortGtin, Offset: 1, Limit: 1}, true, []string{"05909990022434"}, 3},
+		{"past the end", ListOptions{Offset: 5}, true, nil, 3},
+	}
+
+	for _, test := range tests {
+		products, total := db.ListProducts(test.options, test.allPackages)
+		var got []string
+		for _, product := range products {
+			got = append(got, string(product.Package.KodGTIN))
+		}
+		if total != test.total || len(got) != len(test.want) {
+			t.Errorf("%s: ListProducts = %v of %d, want %v of %d", test.name, got, total, test.want, test.total)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: ListProducts = %v, want %v", test.name, got, test.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package database
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+
+	"gorpl/internal/gs1"
+	"gorpl/internal/model"
+)
+
+// progressInterval is the number of products between progress reports
+const progressInterval = 5000
+
+// LoadProgress describes how far loading of a file has progressed
+type LoadProgress struct {
+	Products   int
+	BytesRead  int64
+	TotalBytes int64
+}
+
+// ProgressFunc is called periodically while products are being loaded
+type ProgressFunc func(LoadProgress)
+
+// logProgress is the default ProgressFunc which writes progress to the log
+func logProgress(p LoadProgress) {
+	if p.TotalBytes > 0 {
+		log.Printf("Loaded %d products (%.0f%%)", p.Products, float64(p.BytesRead)*100/float64(p.TotalBytes))
+		return
+	}
+	log.Printf("Loaded %d products (%d bytes)", p.Products, p.BytesRead)
+}
+
+// countingReader counts bytes read from the underlying reader
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// gtinRef points at a package by its position in the products list
+type gtinRef struct {
+	product int
+	pkg     int
+}
+
+// decodeProducts streams products from the XML document one produktLeczniczy at a time
+// GTIN references are collected while decoding, so the index is ready as soon as the document ends
+func decodeProducts(r io.Reader, totalBytes int64, compressed bool, progress ProgressFunc) (*model.ProduktyLecznicze, map[string]*model.ProductInfo, error) {
+	// Progress is measured on the raw input, so it also works for compressed files
+	counter := &countingReader{r: r}
+	var input io.Reader = bufio.NewReaderSize(counter, 1<<20)
+	if compressed {
+		gz, err := gzip.NewReader(input)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error decompressing file: %w", err)
+		}
+		defer gz.Close()
+		input = gz
+	}
+	decoder := xml.NewDecoder(input)
+
+	var produkty *model.ProduktyLecznicze
+	refs := make(map[string]gtinRef)
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error decoding XML: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		// The first element has to be the document root
+		if produkty == nil {
+			if start.Name.Space != model.Namespace || start.Name.Local != "produktyLecznicze" {
+				return nil, nil, fmt.Errorf("error decoding XML: expected element <produktyLecznicze> but have <%s>", start.Name.Local)
+			}
+			produkty = &model.ProduktyLecznicze{XMLName: start.Name}
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "stanNaDzien" {
+					produkty.StanNaDzien = model.DateAsString(attr.Value)
+				}
+			}
+			continue
+		}
+
+		if start.Name.Local != "produktLeczniczy" {
+			if err := decoder.Skip(); err != nil {
+				return nil, nil, fmt.Errorf("error decoding XML: %w", err)
+			}
+			continue
+		}
+
+		var product model.ProduktLeczniczy
+		if err := decoder.DecodeElement(&product, &start); err != nil {
+			return nil, nil, fmt.Errorf("error decoding product: %w", err)
+		}
+
+		collectGtins(refs, &product, len(produkty.ProduktyLecznicze))
+		produkty.ProduktyLecznicze = append(produkty.ProduktyLecznicze, product)
+
+		if progress != nil && len(produkty.ProduktyLecznicze)%progressInterval == 0 {
+			progress(LoadProgress{
+				Products:   len(produkty.ProduktyLecznicze),
+				BytesRead:  counter.n,
+				TotalBytes: totalBytes,
+			})
+		}
+	}
+
+	if produkty == nil {
+		return nil, nil, fmt.Errorf("error decoding XML: document is empty")
+	}
+
+	return produkty, resolveGtinIndex(produkty.ProduktyLecznicze, refs), nil
+}
+
+// collectGtins adds the GTINs of non-deleted packages of a product to refs
+// Valid GTINs are indexed in their normalized GTIN-14 form, invalid ones as they are
+func collectGtins(refs map[string]gtinRef, product *model.ProduktLeczniczy, productIndex int) {
+	if product.Opakowania == nil {
+		return
+	}
+
+	for j := range product.Opakowania.Opakowanie {
+		pkg := &product.Opakowania.Opakowanie[j]
+
+		if pkg.Skasowane == "TAK" {
+			continue
+		}
+
+		ref := gtinRef{product: productIndex, pkg: j}
+
+		if pkg.KodGTIN != "" {
+			refs[gs1.Key(string(pkg.KodGTIN))] = ref
+		}
+
+		if pkg.ZgodyPrezesa != nil {
+			for _, zgoda := range pkg.ZgodyPrezesa.ZgodaPrezesa {
+				if zgoda.GTINZagraniczne != nil {
+					for _, gtin := range zgoda.GTINZagraniczne.GTINZagraniczny {
+						if gtin.Numer != "" {
+							refs[gs1.Key(gtin.Numer)] = ref
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// resolveGtinIndex turns package positions into the GTIN index
+// All GTINs of a package share a single ProductInfo
+func resolveGtinIndex(products []model.ProduktLeczniczy, refs map[string]gtinRef) map[string]*model.ProductInfo {
+	index := make(map[string]*model.ProductInfo, len(refs))
+	infos := make(map[gtinRef]*model.ProductInfo)
+
+	for gtin, ref := range refs {
+		info, ok := infos[ref]
+		if !ok {
+			product := &products[ref.product]
+			info = &model.ProductInfo{
+				Product: product,
+				Package: &product.Opakowania.Opakowanie[ref.pkg],
+			}
+			infos[ref] = info
+		}
+		index[gtin] = info
+	}
+
+	return index
+}
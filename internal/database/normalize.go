@@ -0,0 +1,36 @@
+package database
+
+import "strings"
+
+// polishLetters maps Polish letters with diacritics to their base letters
+var polishLetters = strings.NewReplacer(
+	"ą", "a", "ć", "c", "ę", "e", "ł", "l", "ń", "n",
+	"ó", "o", "ś", "s", "ź", "z", "ż", "z",
+)
+
+// minStemLength is the shortest stem left after removing an ending
+const minStemLength = 3
+
+// inflectionSuffixes are common endings of inflected Polish nouns and adjectives, longest first
+// Diminutive endings (-ka, -ek, -ki) are included, so tabletka, tabletki and tabletek share a stem
+var inflectionSuffixes = []string{
+	"kami", "kach",
+	"ami", "ach", "ych", "ich", "ymi", "imi", "ego", "emu", "owi",
+	"ek", "ka", "ki", "ke", "ce", "ow", "om", "em", "ej", "ym", "im", "ie",
+	"a", "e", "i", "o", "u", "y",
+}
+
+// foldDiacritics lowercases text and replaces Polish letters with their base letters
+func foldDiacritics(text string) string {
+	return polishLetters.Replace(strings.ToLower(text))
+}
+
+// stem removes the inflection ending of a folded word, so different forms of a word share a stem
+func stem(word string) string {
+	for _, suffix := range inflectionSuffixes {
+		if strings.HasSuffix(word, suffix) && len(word)-len(suffix) >= minStemLength {
+			return word[:len(word)-len(suffix)]
+		}
+	}
+	return word
+}
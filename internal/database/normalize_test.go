@@ -0,0 +1,73 @@
+package database
+
+import "testing"
+
+func TestFoldDiacritics(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Maść", "masc"},
+		{"żel", "zel"},
+		{"ŻÓŁĆ", "zolc"},
+		{"Źdźbło", "zdzblo"},
+		{"ąćęłńóśźż", "acelnoszz"},
+		{"Apap Extra", "apap extra"},
+	}
+
+	for _, test := range tests {
+		if got := foldDiacritics(test.text); got != test.want {
+			t.Errorf("foldDiacritics(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestStem(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"tabletka", "tablet"},
+		{"tabletki", "tablet"},
+		{"tabletek", "tablet"},
+		{"tabletkami", "tablet"},
+		{"tabletkach", "tablet"},
+		{"kapsulki", "kapsul"},
+		{"kapsulek", "kapsul"},
+		{"masc", "masc"},
+		// The stem keeps at least minStemLength letters
+		{"zel", "zel"},
+		{"oka", "oka"},
+		{"apap", "apap"},
+	}
+
+	for _, test := range tests {
+		if got := stem(test.word); got != test.want {
+			t.Errorf("stem(%q) = %q, want %q", test.word, got, test.want)
+		}
+	}
+}
+
+func TestSearchFoldsDiacriticsAndForms(t *testing.T) {
+	index := testIndex("Maść majerankowa", "Żel chłodzący", "Apap tabletki powlekane", "Nurofen tabletka")
+
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"masc", []int{0}},
+		{"MAŚĆ", []int{0}},
+		{"zel", []int{1}},
+		{"chlodz", []int{1}},
+		{"tabletka", []int{2, 3}},
+		{"tabletki", []int{2, 3}},
+		{"tabletek", []int{2, 3}},
+		{"apap tabletek", []int{2}},
+	}
+
+	for _, test := range tests {
+		if got := index.search(test.query); !equalInts(got, test.want) {
+			t.Errorf("search(%q) = %v, want %v", test.query, got, test.want)
+		}
+	}
+}
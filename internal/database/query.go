@@ -0,0 +1,213 @@
+package database
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"gorpl/internal/model"
+)
+
+// Dimensions of faceted queries
+const (
+	FacetPostac                = "postac"
+	FacetDrogaPodania          = "drogaPodania"
+	FacetKategoriaDostepnosci  = "kategoriaDostepnosci"
+	FacetTypProcedury          = "typProcedury"
+	FacetRodzajPreparatu       = "rodzajPreparatu"
+	FacetPodmiotOdpowiedzialny = "podmiotOdpowiedzialny"
+)
+
+// FacetDimensions lists the dimensions products can be filtered by
+var FacetDimensions = []string{
+	FacetPostac,
+	FacetDrogaPodania,
+	FacetKategoriaDostepnosci,
+	FacetTypProcedury,
+	FacetRodzajPreparatu,
+	FacetPodmiotOdpowiedzialny,
+}
+
+// ProductQuery selects products by name and attribute values
+type ProductQuery struct {
+	// Words matched like in SearchByName, empty matches all products
+	Text string
+	// Accepted values of each dimension, a product has to have one of them in every filtered dimension
+	// Values are compared ignoring case and diacritics
+	Filters map[string][]string
+}
+
+// FacetValue is a value of a dimension with the number of matching products having it
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// QueryResult holds the products matching a query and the facet counts of each dimension
+// The counts of a dimension take the filters of all other dimensions into account,
+// so they show how many products each value would select
+type QueryResult struct {
+	Products []*model.ProductInfo
+	Facets   map[string][]FacetValue
+}
+
+// ActivePackages returns the packages of a product which are not deleted
+func ActivePackages(product *model.ProduktLeczniczy) []*model.Opakowanie {
+	if product.Opakowania == nil {
+		return nil
+	}
+
+	var packages []*model.Opakowanie
+	for i := range product.Opakowania.Opakowanie {
+		if pkg := &product.Opakowania.Opakowanie[i]; pkg.Skasowane != "TAK" {
+			packages = append(packages, pkg)
+		}
+	}
+	return packages
+}
+
+// facetValues returns the values of a dimension for a product with the given active packages
+func facetValues(product *model.ProduktLeczniczy, packages []*model.Opakowanie, dimension string) []string {
+	var values []string
+	switch dimension {
+	case FacetPostac:
+		values = []string{string(product.NazwaPostaciFarmaceutycznej)}
+	case FacetDrogaPodania:
+		if product.DrogiPodania != nil {
+			for _, route := range product.DrogiPodania.DrogaPodania {
+				values = append(values, route.DrogaPodaniaNazwa)
+			}
+		}
+	case FacetKategoriaDostepnosci:
+		for _, pkg := range packages {
+			values = append(values, string(pkg.KategoriaDostepnosci))
+		}
+	case FacetTypProcedury:
+		values = []string{string(product.TypProcedury)}
+	case FacetRodzajPreparatu:
+		values = []string{string(product.RodzajPreparatu)}
+	case FacetPodmiotOdpowiedzialny:
+		values = []string{product.PodmiotOdpowiedzialny}
+	}
+
+	// Remove empty and duplicate values, so products are counted once per value
+	unique := values[:0]
+	for _, value := range values {
+		if value != "" && !slices.Contains(unique, value) {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// acceptsAny checks whether one of the values is accepted by a filter of folded values
+func acceptsAny(accepted map[string]bool, values []string) bool {
+	for _, value := range values {
+		if accepted[foldDiacritics(value)] {
+			return true
+		}
+	}
+	return false
+}
+
+// Query searches for products by name and attribute values and counts the values of every dimension
+func (db *ProductDatabase) Query(query ProductQuery) *QueryResult {
+	result := &QueryResult{Facets: make(map[string][]FacetValue)}
+
+	// Filters are compared by folded values
+	filters := make(map[string]map[string]bool)
+	for dimension, values := range query.Filters {
+		accepted := make(map[string]bool)
+		for _, value := range values {
+			if value = strings.TrimSpace(value); value != "" {
+				accepted[foldDiacritics(value)] = true
+			}
+		}
+		if len(accepted) > 0 {
+			filters[dimension] = accepted
+		}
+	}
+
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	if db.produkty == nil || db.textIndex == nil {
+		return result
+	}
+
+	var positions []int
+	if strings.TrimSpace(query.Text) != "" {
+		positions = db.textIndex.search(query.Text)
+	} else {
+		positions = make([]int, len(db.produkty.ProduktyLecznicze))
+		for i := range positions {
+			positions[i] = i
+		}
+	}
+
+	counts := make(map[string]map[string]int)
+	for _, dimension := range FacetDimensions {
+		counts[dimension] = make(map[string]int)
+	}
+
+	for _, position := range positions {
+		product := &db.produkty.ProduktyLecznicze[position]
+		packages := ActivePackages(product)
+		if len(packages) == 0 {
+			continue
+		}
+
+		values := make(map[string][]string, len(FacetDimensions))
+		var failed []string
+		for _, dimension := range FacetDimensions {
+			values[dimension] = facetValues(product, packages, dimension)
+			if accepted, ok := filters[dimension]; ok && !acceptsAny(accepted, values[dimension]) {
+				failed = append(failed, dimension)
+			}
+		}
+
+		// A product failing a single filter still counts towards the values of that dimension
+		switch len(failed) {
+		case 0:
+			for dimension, dimensionValues := range values {
+				for _, value := range dimensionValues {
+					counts[dimension][value]++
+				}
+			}
+			result.Products = append(result.Products, &model.ProductInfo{
+				Product: product,
+				Package: matchingPackage(packages, filters[FacetKategoriaDostepnosci]),
+			})
+		case 1:
+			for _, value := range values[failed[0]] {
+				counts[failed[0]][value]++
+			}
+		}
+	}
+
+	for dimension, dimensionCounts := range counts {
+		facet := make([]FacetValue, 0, len(dimensionCounts))
+		for value, count := range dimensionCounts {
+			facet = append(facet, FacetValue{Value: value, Count: count})
+		}
+		sort.Slice(facet, func(i, j int) bool {
+			if facet[i].Count != facet[j].Count {
+				return facet[i].Count > facet[j].Count
+			}
+			return facet[i].Value < facet[j].Value
+		})
+		result.Facets[dimension] = facet
+	}
+
+	return result
+}
+
+// matchingPackage returns the first package with an accepted availability category, or the first package without a filter
+func matchingPackage(packages []*model.Opakowanie, accepted map[string]bool) *model.Opakowanie {
+	for _, pkg := range packages {
+		if accepted == nil || accepted[foldDiacritics(string(pkg.KategoriaDostepnosci))] {
+			return pkg
+		}
+	}
+	return packages[0]
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"gorpl/internal/model"
+)
+
+// Scores of the fields a query matches, each can grow by up to 0.1 with the share of the field's words matched
+const (
+	scoreExactName   = 1.0
+	scoreNamePrefix  = 0.8
+	scoreName        = 0.6
+	scoreOtherName   = 0.4
+	scoreSubstance   = 0.3
+	scoreCoverage    = 0.1
+	popularityWeight = 0.1
+)
+
+// popularity counts how often products are looked up
+type popularity struct {
+	mutex  sync.Mutex
+	counts map[model.BigIntAsString]int
+	max    int
+}
+
+// record counts a lookup of a product
+func (p *popularity) record(id model.BigIntAsString) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.counts == nil {
+		p.counts = make(map[model.BigIntAsString]int)
+	}
+	p.counts[id]++
+	p.max = max(p.max, p.counts[id])
+}
+
+// boost returns a score from 0 to popularityWeight, growing logarithmically with the number of lookups
+func (p *popularity) boost(id model.BigIntAsString) float64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.counts[id] == 0 {
+		return 0
+	}
+	return popularityWeight * math.Log1p(float64(p.counts[id])) / math.Log1p(float64(p.max))
+}
+
+// matchAll checks whether every term is a prefix or another form of one of the words
+func matchAll(terms, words []string) bool {
+	for _, term := range terms {
+		if !matchesWord(term, words) {
+			return false
+		}
+	}
+	return len(terms) > 0
+}
+
+// matchLeading checks whether the terms match the first words in order
+func matchLeading(terms, words []string) bool {
+	if len(terms) > len(words) {
+		return false
+	}
+	for i, term := range terms {
+		if !matchesWord(term, words[i:i+1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// coverage returns the share of words matched by the terms, from 0 to scoreCoverage
+func coverage(terms, words []string) float64 {
+	return scoreCoverage * float64(min(len(terms), len(words))) / float64(len(words))
+}
+
+// relevance scores how well a product matching every term of a query fits it, from 0 to 1
+// Exact trade name matches come first, then trade names starting with the query, trade names
+// containing the query, common or previous names containing it and finally substance matches
+func relevance(product *model.ProduktLeczniczy, terms []string) float64 {
+	name := tokenize(string(product.NazwaProduktu))
+	switch {
+	case len(name) == len(terms) && equalWords(terms, name):
+		return scoreExactName
+	case matchLeading(terms, name):
+		return scoreNamePrefix + coverage(terms, name)
+	case matchAll(terms, name):
+		return scoreName + coverage(terms, name)
+	}
+
+	for _, other := range []model.LimitedString{product.NazwaPowszechnieStosowana, product.NazwaPoprzedniaProduktu} {
+		if words := tokenize(string(other)); matchAll(terms, words) {
+			return scoreOtherName + coverage(terms, words)
+		}
+	}
+	return scoreSubstance
+}
+
+// equalWords checks whether the terms are the words or other forms of them
+func equalWords(terms, words []string) bool {
+	for i := range terms {
+		if terms[i] != words[i] && stem(terms[i]) != stem(words[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// RecordLookup counts a lookup of a product, frequently looked up products can be boosted in searches
+func (db *ProductDatabase) RecordLookup(id model.BigIntAsString) {
+	db.lookups.record(id)
+}
+
+// RankedSearchByName searches for products like SearchByName and sorts them by relevance, best first
+// With boost, frequently looked up products get up to 0.1 added to their score
+func (db *ProductDatabase) RankedSearchByName(query string, boost bool) []SearchResult {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	if query == "" || db.textIndex == nil {
+		return nil
+	}
+
+	terms := tokenize(query)
+	var results []SearchResult
+	for _, position := range db.textIndex.search(query) {
+		product := &db.produkty.ProduktyLecznicze[position]
+		info := firstPackage(product)
+		if info == nil {
+			continue
+		}
+
+		score := relevance(product, terms)
+		if boost {
+			score += db.lookups.boost(product.ID)
+		}
+		results = append(results, SearchResult{ProductInfo: info, Score: math.Round(score*1000) / 1000})
+	}
+
+	// Equal scores prefer shorter trade names, plain products before their variants,
+	// then keep the document order of the positions
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return len(results[i].Product.NazwaProduktu) < len(results[j].Product.NazwaProduktu)
+	})
+
+	return results
+}
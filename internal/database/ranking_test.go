@@ -0,0 +1,106 @@
+package database
+
+import (
+	"testing"
+
+	"gorpl/internal/model"
+)
+
+// rankingProduct creates a product with an active package
+func rankingProduct(id, name, commonName, substance string) model.ProduktLeczniczy {
+	product := model.ProduktLeczniczy{
+		ID:                        model.BigIntAsString(id),
+		NazwaProduktu:             model.LimitedString(name),
+		NazwaPowszechnieStosowana: model.LimitedString(commonName),
+		Opakowania:                &model.Opakowania{Opakowanie: []model.Opakowanie{{ID: model.BigIntAsString(id + "1")}}},
+	}
+	if substance != "" {
+		product.SubstancjeCzynne = &model.SubstancjeCzynne{
+			SubstancjaCzynna: []model.SubstancjaCzynna{{NazwaSubstancji: substance}},
+		}
+	}
+	return product
+}
+
+// rankingDatabase creates a database holding the given products
+func rankingDatabase(products ...model.ProduktLeczniczy) *ProductDatabase {
+	db := NewProductDatabase()
+	db.produkty = &model.ProduktyLecznicze{ProduktyLecznicze: products}
+	db.textIndex = buildTextIndex(products)
+	return db
+}
+
+func TestRankedSearchByName(t *testing.T) {
+	db := rankingDatabase(
+		rankingProduct("1", "Paracetamol Apap Combo", "Paracetamolum", ""),
+		rankingProduct("2", "Apap Extra Noc", "Paracetamolum + Coffeinum", ""),
+		rankingProduct("3", "Codipar", "Apap compositum", ""),
+		rankingProduct("4", "Apap Extra", "Paracetamolum", ""),
+		rankingProduct("5", "Febrisan", "Paracetamolum", "Apap substancja"),
+		rankingProduct("6", "Apap", "Paracetamolum", ""),
+	)
+
+	results := db.RankedSearchByName("apap", false)
+
+	// Exact name, names starting with the query (shorter first), name containing it,
+	// common name and finally substance
+	want := []string{"Apap", "Apap Extra", "Apap Extra Noc", "Paracetamol Apap Combo", "Codipar", "Febrisan"}
+	if len(results) != len(want) {
+		t.Fatalf("RankedSearchByName(%q) returned %d results, want %d", "apap", len(results), len(want))
+	}
+	for i, result := range results {
+		if name := string(result.Product.NazwaProduktu); name != want[i] {
+			t.Errorf("result %d = %q (score %v), want %q", i, name, result.Score, want[i])
+		}
+	}
+	if results[0].Score != scoreExactName {
+		t.Errorf("exact match score = %v, want %v", results[0].Score, scoreExactName)
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i].Score > results[i-1].Score {
+			t.Errorf("result %d scores %v, more than the previous %v", i, results[i].Score, results[i-1].Score)
+		}
+	}
+}
+
+func TestRelevanceTiers(t *testing.T) {
+	tests := []struct {
+		name    string
+		product model.ProduktLeczniczy
+		query   string
+		min     float64
+		max     float64
+	}{
+		{"exact name", rankingProduct("1", "Apap", "", ""), "apap", scoreExactName, scoreExactName},
+		{"exact name in another form", rankingProduct("1", "Apap tabletki", "", ""), "apap tabletka", scoreExactName, scoreExactName},
+		{"name prefix", rankingProduct("1", "Apap Extra", "", ""), "apap", scoreNamePrefix, scoreNamePrefix + scoreCoverage},
+		{"name", rankingProduct("1", "Extra Apap", "", ""), "apap", scoreName, scoreName + scoreCoverage},
+		{"common name", rankingProduct("1", "Codipar", "Apap", ""), "apap", scoreOtherName, scoreOtherName + scoreCoverage},
+		{"substance", rankingProduct("1", "Febrisan", "", "Apap"), "apap", scoreSubstance, scoreSubstance},
+	}
+
+	for _, test := range tests {
+		score := relevance(&test.product, tokenize(test.query))
+		if score < test.min || score > test.max {
+			t.Errorf("%s: relevance = %v, want between %v and %v", test.name, score, test.min, test.max)
+		}
+	}
+}
+
+func TestRankedSearchByNameBoost(t *testing.T) {
+	db := rankingDatabase(
+		rankingProduct("1", "Apap Extra", "", ""),
+		rankingProduct("2", "Apap Noc", "", ""),
+	)
+	db.RecordLookup("1")
+
+	results := db.RankedSearchByName("apap", false)
+	if name := string(results[0].Product.NazwaProduktu); name != "Apap Noc" {
+		t.Errorf("without boost first result = %q, want %q", name, "Apap Noc")
+	}
+
+	results = db.RankedSearchByName("apap", true)
+	if name := string(results[0].Product.NazwaProduktu); name != "Apap Extra" {
+		t.Errorf("with boost first result = %q, want %q", name, "Apap Extra")
+	}
+}
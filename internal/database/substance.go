@@ -0,0 +1,197 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gorpl/internal/model"
+)
+
+// ErrInvalidSubstanceQuery is returned when a substance query cannot be parsed
+var ErrInvalidSubstanceQuery = errors.New("invalid substance query")
+
+// unitAliases maps alternative spellings of units to the ones used in the registry
+var unitAliases = map[string]string{
+	"mcg": "µg",
+	"ug":  "µg",
+	"μg":  "µg",
+	"j":   "j.m.",
+	"jm":  "j.m.",
+	"iu":  "j.m.",
+}
+
+// SubstanceQuery selects products containing an active substance, optionally in a given amount
+type SubstanceQuery struct {
+	// Words of the substance name, each has to be a prefix of a word in the name
+	Name string
+	// Amount of the substance, 0 matches any amount
+	Amount float64
+	// Unit of the amount, empty matches any unit
+	Unit string
+	// Amount and unit of the preparation containing the amount, e.g. 5 ml in 100 mg/5 ml,
+	// an empty unit matches any preparation amount
+	PerAmount float64
+	PerUnit   string
+}
+
+// ParseSubstanceQuery parses a substance name optionally followed by an amount and a unit,
+// e.g. "ibuprofen", "ibuprofen 400 mg", "ibuprofen 400mg" or "ibuprofen 100 mg/5 ml"
+func ParseSubstanceQuery(text string) (SubstanceQuery, error) {
+	words := strings.Fields(text)
+
+	// The amount is the first word starting with a digit, the rest is its unit
+	for i, word := range words {
+		if i == 0 || !unicode.IsDigit(rune(word[0])) {
+			continue
+		}
+
+		amountText, unit := splitAmount(strings.Join(words[i:], ""))
+		amount, err := parseAmount(amountText)
+		if err != nil || amount <= 0 {
+			return SubstanceQuery{}, fmt.Errorf("%w: invalid amount %q", ErrInvalidSubstanceQuery, amountText)
+		}
+		query := SubstanceQuery{
+			Name:   strings.Join(words[:i], " "),
+			Amount: amount,
+			Unit:   normalizeUnit(unit),
+		}
+
+		// A compound unit gives the amount of the preparation, e.g. mg/5ml or mg/ml
+		if unit, per, ok := strings.Cut(query.Unit, "/"); ok {
+			perText, perUnit := splitAmount(per)
+			query.Unit, query.PerAmount, query.PerUnit = unit, 1, normalizeUnit(perUnit)
+			if perText != "" {
+				if query.PerAmount, err = parseAmount(perText); err != nil || query.PerAmount <= 0 {
+					return SubstanceQuery{}, fmt.Errorf("%w: invalid amount %q", ErrInvalidSubstanceQuery, perText)
+				}
+			}
+			if query.Unit == "" || query.PerUnit == "" {
+				return SubstanceQuery{}, fmt.Errorf("%w: invalid unit %q", ErrInvalidSubstanceQuery, unit+"/"+per)
+			}
+		}
+
+		return query, nil
+	}
+
+	if len(words) == 0 {
+		return SubstanceQuery{}, fmt.Errorf("%w: missing substance name", ErrInvalidSubstanceQuery)
+	}
+	return SubstanceQuery{Name: strings.Join(words, " ")}, nil
+}
+
+// splitAmount splits text into its leading number, with a decimal comma or point, and the rest
+func splitAmount(text string) (string, string) {
+	end := strings.IndexFunc(text, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != ',' && r != '.'
+	})
+	if end < 0 {
+		end = len(text)
+	}
+	return text[:end], text[end:]
+}
+
+// parseAmount parses an amount with a decimal comma or point
+func parseAmount(text string) (float64, error) {
+	return strconv.ParseFloat(strings.ReplaceAll(text, ",", "."), 64)
+}
+
+// normalizeUnit returns the unit in lowercase without spaces, with aliases replaced
+func normalizeUnit(unit string) string {
+	unit = strings.ToLower(strings.Join(strings.Fields(unit), ""))
+	if alias, ok := unitAliases[unit]; ok {
+		return alias
+	}
+	return unit
+}
+
+// matches checks whether an active substance has the name and amount of the query
+func (q SubstanceQuery) matches(substance *model.SubstancjaCzynna) bool {
+	words := tokenize(substance.NazwaSubstancji)
+	for _, term := range tokenize(q.Name) {
+		if !matchesWord(term, words) {
+			return false
+		}
+	}
+
+	if q.Amount > 0 {
+		amount, err := parseAmount(substance.IloscSubstancji)
+		if err != nil || amount != q.Amount {
+			return false
+		}
+	}
+	if q.Unit != "" && normalizeUnit(substance.JednostkaMiaryIlosciSubstancji) != q.Unit {
+		return false
+	}
+	if q.PerUnit != "" {
+		amount, err := parseAmount(substance.IloscPreparatu)
+		if err != nil || amount != q.PerAmount || normalizeUnit(substance.JednostkaMiaryIlosciPreparatu) != q.PerUnit {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesWord checks whether term is a prefix or another form of one of the words
+func matchesWord(term string, words []string) bool {
+	for _, word := range words {
+		if strings.HasPrefix(word, term) || stem(word) == stem(term) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsSubstance checks whether a product has an active substance matching the query
+func containsSubstance(product *model.ProduktLeczniczy, query SubstanceQuery) bool {
+	if product.SubstancjeCzynne == nil {
+		return false
+	}
+
+	for i := range product.SubstancjeCzynne.SubstancjaCzynna {
+		if query.matches(&product.SubstancjeCzynne.SubstancjaCzynna[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchBySubstances searches for products containing all of the given active substances
+func (db *ProductDatabase) SearchBySubstances(queries []SubstanceQuery) []*model.ProductInfo {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	if len(queries) == 0 || db.textIndex == nil {
+		return nil
+	}
+
+	// Substance names are indexed with the product names, the index narrows down the candidates
+	names := make([]string, len(queries))
+	for i, query := range queries {
+		names[i] = query.Name
+	}
+
+	var results []*model.ProductInfo
+	for _, position := range db.textIndex.search(strings.Join(names, " ")) {
+		product := &db.produkty.ProduktyLecznicze[position]
+
+		matchesAll := true
+		for _, query := range queries {
+			if !containsSubstance(product, query) {
+				matchesAll = false
+				break
+			}
+		}
+		if !matchesAll {
+			continue
+		}
+
+		if info := firstPackage(product); info != nil {
+			results = append(results, info)
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"gorpl/internal/model"
+)
+
+func TestParseSubstanceQuery(t *testing.T) {
+	tests := []struct {
+		text string
+		want SubstanceQuery
+		err  error
+	}{
+		{"ibuprofen", SubstanceQuery{Name: "ibuprofen"}, nil},
+		{"ibuprofen 400 mg", SubstanceQuery{Name: "ibuprofen", Amount: 400, Unit: "mg"}, nil},
+		{"ibuprofen 400mg", SubstanceQuery{Name: "ibuprofen", Amount: 400, Unit: "mg"}, nil},
+		{"kwas acetylosalicylowy 0,5 g", SubstanceQuery{Name: "kwas acetylosalicylowy", Amount: 0.5, Unit: "g"}, nil},
+		{"cholekalcyferol 1000 IU", SubstanceQuery{Name: "cholekalcyferol", Amount: 1000, Unit: "j.m."}, nil},
+		{"ibuprofen 100mg/5ml", SubstanceQuery{Name: "ibuprofen", Amount: 100, Unit: "mg", PerAmount: 5, PerUnit: "ml"}, nil},
+		{"ibuprofen 100 mg/5 ml", SubstanceQuery{Name: "ibuprofen", Amount: 100, Unit: "mg", PerAmount: 5, PerUnit: "ml"}, nil},
+		{"ibuprofen 20 mg/ml", SubstanceQuery{Name: "ibuprofen", Amount: 20, Unit: "mg", PerAmount: 1, PerUnit: "ml"}, nil},
+		{"ibuprofen 400", SubstanceQuery{Name: "ibuprofen", Amount: 400}, nil},
+		{"", SubstanceQuery{}, ErrInvalidSubstanceQuery},
+		{"ibuprofen 0 mg", SubstanceQuery{}, ErrInvalidSubstanceQuery},
+		{"ibuprofen 1.2.3 mg", SubstanceQuery{}, ErrInvalidSubstanceQuery},
+		{"ibuprofen 100 mg/", SubstanceQuery{}, ErrInvalidSubstanceQuery},
+		{"ibuprofen 100 mg/0 ml", SubstanceQuery{}, ErrInvalidSubstanceQuery},
+	}
+
+	for _, test := range tests {
+		got, err := ParseSubstanceQuery(test.text)
+		if !errors.Is(err, test.err) || (test.err == nil && err != nil) {
+			t.Errorf("ParseSubstanceQuery(%q) error = %v, want %v", test.text, err, test.err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseSubstanceQuery(%q) = %+v, want %+v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestSubstanceQueryMatches(t *testing.T) {
+	suspension := model.SubstancjaCzynna{
+		NazwaSubstancji:                "Ibuprofenum",
+		IloscSubstancji:                "100",
+		JednostkaMiaryIlosciSubstancji: "mg",
+		IloscPreparatu:                 "5",
+		JednostkaMiaryIlosciPreparatu:  "ml",
+	}
+
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"ibuprofen", true},
+		{"ibuprofen 100 mg", true},
+		{"ibuprofen 100mg/5ml", true},
+		{"ibuprofen 100 mg/10 ml", false},
+		{"ibuprofen 200mg/5ml", false},
+		{"ibuprofen 100 mg/5 g", false},
+	}
+
+	for _, test := range tests {
+		query, err := ParseSubstanceQuery(test.text)
+		if err != nil {
+			t.Fatalf("ParseSubstanceQuery(%q): %v", test.text, err)
+		}
+		if got := query.matches(&suspension); got != test.want {
+			t.Errorf("%q matches = %v, want %v", test.text, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"sort"
+	"strings"
+
+	"gorpl/internal/model"
+)
+
+// Suggestion is a name completing a prefix with the number of products having it
+type Suggestion struct {
+	Text  string `json:"text"`
+	Count int    `json:"count"`
+}
+
+// suggestion is a suggested name with its normalized form for prefix matching
+type suggestion struct {
+	key string
+	Suggestion
+}
+
+// suggestionKey normalizes a name or prefix like search queries
+func suggestionKey(text string) string {
+	return strings.Join(tokenize(text), " ")
+}
+
+// suggestedNames returns the trade, common and active substance names of a product
+func suggestedNames(product *model.ProduktLeczniczy) []string {
+	names := []string{string(product.NazwaProduktu), string(product.NazwaPowszechnieStosowana)}
+	if product.SubstancjeCzynne != nil {
+		for _, substance := range product.SubstancjeCzynne.SubstancjaCzynna {
+			names = append(names, substance.NazwaSubstancji)
+		}
+	}
+	return names
+}
+
+// buildSuggestions collects the distinct names of all products sorted by their normalized form
+// Names differing only in case, diacritics or punctuation are merged and products counted once
+func buildSuggestions(products []model.ProduktLeczniczy) []suggestion {
+	byKey := make(map[string]*suggestion)
+	lastPosition := make(map[string]int)
+
+	for i := range products {
+		for _, name := range suggestedNames(&products[i]) {
+			key := suggestionKey(name)
+			if key == "" {
+				continue
+			}
+
+			entry, ok := byKey[key]
+			if !ok {
+				entry = &suggestion{key: key, Suggestion: Suggestion{Text: strings.TrimSpace(name)}}
+				byKey[key] = entry
+			} else if last := lastPosition[key]; last == i {
+				continue
+			}
+			lastPosition[key] = i
+			entry.Count++
+		}
+	}
+
+	suggestions := make([]suggestion, 0, len(byKey))
+	for _, entry := range byKey {
+		suggestions = append(suggestions, *entry)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		return suggestions[i].key < suggestions[j].key
+	})
+	return suggestions
+}
+
+// suggest returns up to limit names starting with prefix, the most common first
+func (idx *textIndex) suggest(prefix string, limit int) []Suggestion {
+	key := suggestionKey(prefix)
+	if key == "" || limit <= 0 {
+		return []Suggestion{}
+	}
+
+	start := sort.Search(len(idx.suggestions), func(i int) bool {
+		return idx.suggestions[i].key >= key
+	})
+
+	// Keep the best suggestions sorted by insertion, limit is small
+	top := make([]Suggestion, 0, limit)
+	better := func(a, b Suggestion) bool {
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Text < b.Text
+	}
+	for i := start; i < len(idx.suggestions) && strings.HasPrefix(idx.suggestions[i].key, key); i++ {
+		candidate := idx.suggestions[i].Suggestion
+		if len(top) == limit && !better(candidate, top[limit-1]) {
+			continue
+		}
+		if len(top) < limit {
+			top = append(top, candidate)
+		}
+		j := len(top) - 1
+		for ; j > 0 && better(candidate, top[j-1]); j-- {
+			top[j] = top[j-1]
+		}
+		top[j] = candidate
+	}
+
+	return top
+}
+
+// Suggest returns up to limit distinct trade, common and substance names starting with prefix
+// with the number of products having each name, the most common first
+func (db *ProductDatabase) Suggest(prefix string, limit int) []Suggestion {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	if db.textIndex == nil {
+		return []Suggestion{}
+	}
+	return db.textIndex.suggest(prefix, limit)
+}
@@ -0,0 +1,320 @@
+package database
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gorpl/internal/model"
+)
+
+// textIndex is an inverted index of words in product and substance names
+type textIndex struct {
+	// Sorted unique terms, for finding all terms with a prefix
+	terms []string
+	// Terms as runes, for fuzzy matching
+	runes [][]rune
+	// Term -> sorted positions of products containing it
+	postings map[string][]int
+	// Stem -> sorted positions of products containing a word with that stem
+	stems map[string][]int
+	// Number of indexed products
+	size int
+	// Distinct names sorted by their normalized form, for autocompletion
+	suggestions []suggestion
+}
+
+// tokenize splits text into lowercase words without diacritics
+func tokenize(text string) []string {
+	return strings.FieldsFunc(foldDiacritics(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// indexedNames returns the names of a product which are searchable
+func indexedNames(product *model.ProduktLeczniczy) []string {
+	names := []string{
+		string(product.NazwaProduktu),
+		string(product.NazwaPowszechnieStosowana),
+		string(product.NazwaPoprzedniaProduktu),
+	}
+	if product.SubstancjeCzynne != nil {
+		for _, substance := range product.SubstancjeCzynne.SubstancjaCzynna {
+			names = append(names, substance.NazwaSubstancji)
+		}
+	}
+	return names
+}
+
+// buildTextIndex indexes the names of all products
+func buildTextIndex(products []model.ProduktLeczniczy) *textIndex {
+	index := &textIndex{postings: make(map[string][]int), stems: make(map[string][]int), size: len(products)}
+
+	for i := range products {
+		for _, name := range indexedNames(&products[i]) {
+			for _, term := range tokenize(name) {
+				addPosition(index.postings, term, i)
+				addPosition(index.stems, stem(term), i)
+			}
+		}
+	}
+
+	index.terms = make([]string, 0, len(index.postings))
+	for term := range index.postings {
+		index.terms = append(index.terms, term)
+	}
+	sort.Strings(index.terms)
+
+	index.runes = make([][]rune, len(index.terms))
+	for i, term := range index.terms {
+		index.runes[i] = []rune(term)
+	}
+
+	index.suggestions = buildSuggestions(products)
+
+	return index
+}
+
+// addPosition adds the position of a product to the postings of key
+func addPosition(postings map[string][]int, key string, position int) {
+	positions := postings[key]
+	// Products are indexed in order, so a duplicate can only be the last entry
+	if len(positions) > 0 && positions[len(positions)-1] == position {
+		return
+	}
+	postings[key] = append(positions, position)
+}
+
+// prefixMatches returns the sorted positions of products with a word starting with prefix
+func (idx *textIndex) prefixMatches(prefix string) []int {
+	start := sort.SearchStrings(idx.terms, prefix)
+
+	var lists [][]int
+	for i := start; i < len(idx.terms) && strings.HasPrefix(idx.terms[i], prefix); i++ {
+		lists = append(lists, idx.postings[idx.terms[i]])
+	}
+
+	switch len(lists) {
+	case 0:
+		return nil
+	case 1:
+		return lists[0]
+	}
+
+	// Marking positions keeps the union sorted without sorting it
+	marked := make([]bool, idx.size)
+	for _, list := range lists {
+		for _, position := range list {
+			marked[position] = true
+		}
+	}
+	var positions []int
+	for position, ok := range marked {
+		if ok {
+			positions = append(positions, position)
+		}
+	}
+	return positions
+}
+
+// termMatches returns the sorted positions of products with a word starting with term
+// or another form of the same word
+func (idx *textIndex) termMatches(term string) []int {
+	return union(idx.prefixMatches(term), idx.stems[stem(term)])
+}
+
+// search returns the sorted positions of products matching every word of the query
+func (idx *textIndex) search(query string) []int {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	var result []int
+	for i, term := range terms {
+		positions := idx.termMatches(term)
+		if i == 0 {
+			result = positions
+		} else {
+			result = intersect(result, positions)
+		}
+		if len(result) == 0 {
+			return nil
+		}
+	}
+	return result
+}
+
+// intersect returns the positions present in both sorted lists
+func intersect(a, b []int) []int {
+	var result []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// union returns the positions present in any of the sorted lists
+func union(a, b []int) []int {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
+
+	result := make([]int, 0, max(len(a), len(b)))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			result = append(result, a[i])
+			i++
+		case a[i] > b[j]:
+			result = append(result, b[j])
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	result = append(result, a[i:]...)
+	return append(result, b[j:]...)
+}
+
+// scoredPosition is the position of a product matching a fuzzy search and its similarity to the query
+type scoredPosition struct {
+	position int
+	score    float64
+}
+
+// maxEdits returns how many typos are tolerated in a query word
+func maxEdits(term []rune) int {
+	switch {
+	case len(term) <= 3:
+		return 0
+	case len(term) <= 5:
+		return 1
+	case len(term) <= 8:
+		return 2
+	default:
+		return len(term) / 3
+	}
+}
+
+// prefixDistance returns the smallest edit distance between query and any prefix of term
+// The computation stops early and returns a value above limit when the distance exceeds it
+// rows has to hold three slices of at least len(term)+1 elements
+func prefixDistance(query, term []rune, limit int, rows *[3][]int) int {
+	before, previous, current := rows[0][:len(term)+1], rows[1][:len(term)+1], rows[2][:len(term)+1]
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(query); i++ {
+		current[0] = i
+		rowMin := current[0]
+		for j := 1; j <= len(term); j++ {
+			cost := 1
+			if query[i-1] == term[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			// Transposition of two adjacent characters
+			if i > 1 && j > 1 && query[i-1] == term[j-2] && query[i-2] == term[j-1] {
+				current[j] = min(current[j], before[j-2]+1)
+			}
+			rowMin = min(rowMin, current[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		before, previous, current = previous, current, before
+	}
+
+	// previous holds the last row, the query may end anywhere in the term
+	return slices.Min(previous)
+}
+
+// fuzzyMatches returns the products with a word similar to the beginning of term and the best similarity per product
+func (idx *textIndex) fuzzyMatches(term string) map[int]float64 {
+	query := []rune(term)
+	limit := maxEdits(query)
+	scores := make(map[int]float64)
+
+	var rows [3][]int
+	for i, candidate := range idx.runes {
+		// Even the shortest prefix needs more edits than allowed
+		if len(query)-len(candidate) > limit {
+			continue
+		}
+		if len(rows[0]) <= len(candidate) {
+			for k := range rows {
+				rows[k] = make([]int, len(candidate)+1)
+			}
+		}
+
+		distance := prefixDistance(query, candidate, limit, &rows)
+		if distance > limit {
+			continue
+		}
+		score := 1 - float64(distance)/float64(len(query))
+		for _, position := range idx.postings[idx.terms[i]] {
+			if score > scores[position] {
+				scores[position] = score
+			}
+		}
+	}
+
+	return scores
+}
+
+// fuzzySearch returns products matching every word of the query with typos tolerated, best matches first
+// The score of a product is the average similarity of the query words
+func (idx *textIndex) fuzzySearch(query string) []scoredPosition {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	var totals map[int]float64
+	for i, term := range terms {
+		scores := idx.fuzzyMatches(term)
+		if i == 0 {
+			totals = scores
+			continue
+		}
+		for position, total := range totals {
+			score, ok := scores[position]
+			if !ok {
+				delete(totals, position)
+				continue
+			}
+			totals[position] = total + score
+		}
+	}
+
+	results := make([]scoredPosition, 0, len(totals))
+	for position, total := range totals {
+		results = append(results, scoredPosition{position: position, score: total / float64(len(terms))})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].position < results[j].position
+	})
+
+	return results
+}
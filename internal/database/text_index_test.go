@@ -0,0 +1,128 @@
+package database
+
+import (
+	"testing"
+
+	"gorpl/internal/model"
+)
+
+// testIndex indexes products with the given trade names, positions follow the order of names
+func testIndex(names ...string) *textIndex {
+	products := make([]model.ProduktLeczniczy, len(names))
+	for i, name := range names {
+		products[i].NazwaProduktu = model.LimitedString(name)
+	}
+	return buildTextIndex(products)
+}
+
+func TestMaxEdits(t *testing.T) {
+	tests := []struct {
+		term string
+		want int
+	}{
+		{"apa", 0},
+		{"apap", 1},
+		{"ibupr", 1},
+		{"ibupro", 2},
+		{"ibuprofe", 2},
+		{"ibuprofen", 3},
+		{"paracetamolum", 4},
+	}
+
+	for _, test := range tests {
+		if got := maxEdits([]rune(test.term)); got != test.want {
+			t.Errorf("maxEdits(%q) = %d, want %d", test.term, got, test.want)
+		}
+	}
+}
+
+func TestPrefixDistance(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		term  string
+		limit int
+		want  int
+	}{
+		{"equal", "ibuprofen", "ibuprofen", 3, 0},
+		{"prefix", "ibu", "ibuprofen", 0, 0},
+		{"deletion", "ibuprfen", "ibuprofen", 2, 1},
+		{"insertion", "ibupprofen", "ibuprofen", 3, 1},
+		{"substitution", "ibuprofan", "ibuprofen", 3, 1},
+		{"transposition", "ibuporfen", "ibuprofen", 3, 1},
+		{"transposition at start", "paap", "apap", 1, 1},
+		{"transposition in prefix", "ibpu", "ibuprofen", 1, 1},
+		{"two typos", "ibuporfan", "ibuprofen", 3, 2},
+		{"over limit", "xyzw", "apap", 1, 2},
+		{"over limit stops early", "ibuprofen", "apap", 2, 3},
+	}
+
+	for _, test := range tests {
+		query, term := []rune(test.query), []rune(test.term)
+		var rows [3][]int
+		for i := range rows {
+			rows[i] = make([]int, len(term)+1)
+		}
+		if got := prefixDistance(query, term, test.limit, &rows); got != test.want {
+			t.Errorf("%s: prefixDistance(%q, %q, %d) = %d, want %d", test.name, test.query, test.term, test.limit, got, test.want)
+		}
+	}
+}
+
+func TestFuzzySearch(t *testing.T) {
+	index := testIndex("Ibuprofen", "Apap", "Paracetamol", "Ibuprom Max")
+
+	tests := []struct {
+		name  string
+		query string
+		want  []int
+	}{
+		{"exact", "apap", []int{1}},
+		{"transposition", "paap", []int{1}},
+		{"one typo in a short word", "apab", []int{1}},
+		{"no typos in three letters", "apb", nil},
+		{"two typos", "parcetamal", []int{2}},
+		{"too many typos", "prcxtmxl", nil},
+		{"prefix with a typo", "ibpur", []int{0, 3}},
+		{"every word has to match", "ibuporm max", []int{3}},
+		{"unmatched word", "ibuprom xyz", nil},
+	}
+
+	for _, test := range tests {
+		results := index.fuzzySearch(test.query)
+		var got []int
+		for _, result := range results {
+			got = append(got, result.position)
+		}
+		if !equalInts(got, test.want) {
+			t.Errorf("%s: fuzzySearch(%q) = %v, want %v", test.name, test.query, got, test.want)
+		}
+	}
+}
+
+func TestFuzzySearchScores(t *testing.T) {
+	index := testIndex("Ibuprofen", "Ibuprom")
+
+	results := index.fuzzySearch("ibuprofen")
+	if len(results) != 2 {
+		t.Fatalf("fuzzySearch(%q) returned %d results, want 2", "ibuprofen", len(results))
+	}
+	if results[0].position != 0 || results[0].score != 1 {
+		t.Errorf("best result = %+v, want an exact match of position 0", results[0])
+	}
+	if results[1].score >= 1 || results[1].score <= 0 {
+		t.Errorf("similar result score = %v, want between 0 and 1", results[1].score)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,258 @@
+// Package diff contains code for comparing registry snapshots
+package diff
+
+import (
+	"strings"
+	"time"
+
+	"gorpl/internal/model"
+)
+
+// Kinds of changes between snapshots
+const (
+	ProductAdded        = "productAdded"
+	ProductRemoved      = "productRemoved"
+	ProductRenamed      = "productRenamed"
+	AtcChanged          = "atcChanged"
+	PackageAdded        = "packageAdded"
+	PackageRemoved      = "packageRemoved"
+	PackageWithdrawn    = "packageWithdrawn"
+	PackageRestored     = "packageRestored"
+	GtinChanged         = "gtinChanged"
+	AvailabilityChanged = "availabilityChanged"
+)
+
+// Change describes a single difference between two snapshots
+type Change struct {
+	Type          string   `json:"type"`
+	ProductID     string   `json:"productId"`
+	NazwaProduktu string   `json:"nazwaProduktu"`
+	KodyATC       []string `json:"kodyATC,omitempty"`
+	PackageID     string   `json:"packageId,omitempty"`
+	GTIN          string   `json:"gtin,omitempty"`
+	// GTINs of the product's packages, only set on product level changes
+	GTINs    []string `json:"gtins,omitempty"`
+	OldValue string   `json:"oldValue,omitempty"`
+	NewValue string   `json:"newValue,omitempty"`
+}
+
+// Report lists the differences between two snapshots
+type Report struct {
+	From        string         `json:"from"`
+	To          string         `json:"to"`
+	FromFile    string         `json:"fromFile"`
+	ToFile      string         `json:"toFile"`
+	GeneratedAt time.Time      `json:"generatedAt"`
+	Counts      map[string]int `json:"counts"`
+	Changes     []Change       `json:"changes"`
+}
+
+// Compare compares two snapshots at product and package level
+// Products are matched by their ID, packages by their ID or by GTIN when they have no ID
+func Compare(from, to *model.ProduktyLecznicze) *Report {
+	report := &Report{
+		From:        string(from.StanNaDzien),
+		To:          string(to.StanNaDzien),
+		GeneratedAt: time.Now(),
+		Counts:      make(map[string]int),
+		Changes:     []Change{},
+	}
+
+	add := func(change Change) {
+		report.Counts[change.Type]++
+		report.Changes = append(report.Changes, change)
+	}
+
+	oldProducts := make(map[model.BigIntAsString]*model.ProduktLeczniczy, len(from.ProduktyLecznicze))
+	for i := range from.ProduktyLecznicze {
+		oldProducts[from.ProduktyLecznicze[i].ID] = &from.ProduktyLecznicze[i]
+	}
+	seen := make(map[model.BigIntAsString]bool, len(to.ProduktyLecznicze))
+
+	for i := range to.ProduktyLecznicze {
+		product := &to.ProduktyLecznicze[i]
+		seen[product.ID] = true
+
+		previous, ok := oldProducts[product.ID]
+		if !ok {
+			add(productChange(ProductAdded, product))
+			addPackages(PackageAdded, product, add)
+			continue
+		}
+		compareProducts(previous, product, add)
+	}
+
+	for i := range from.ProduktyLecznicze {
+		product := &from.ProduktyLecznicze[i]
+		if !seen[product.ID] {
+			add(productChange(ProductRemoved, product))
+			addPackages(PackageRemoved, product, add)
+		}
+	}
+
+	return report
+}
+
+// compareProducts reports changes between two versions of a product
+func compareProducts(previous, current *model.ProduktLeczniczy, add func(Change)) {
+	base := productChange("", current)
+	packageBase := base
+	packageBase.GTINs = nil
+
+	if previous.NazwaProduktu != current.NazwaProduktu {
+		change := base
+		change.Type = ProductRenamed
+		change.OldValue = string(previous.NazwaProduktu)
+		change.NewValue = string(current.NazwaProduktu)
+		add(change)
+	}
+
+	if oldCodes, newCodes := atcCodes(previous), atcCodes(current); oldCodes != newCodes {
+		change := base
+		change.Type = AtcChanged
+		change.OldValue = oldCodes
+		change.NewValue = newCodes
+		add(change)
+	}
+
+	oldPackages := packages(previous)
+	seen := make(map[string]bool)
+
+	for _, pkg := range packageList(current) {
+		key := packageKey(pkg)
+		seen[key] = true
+
+		change := packageBase
+		change.PackageID = string(pkg.ID)
+		change.GTIN = string(pkg.KodGTIN)
+
+		prevPkg, ok := oldPackages[key]
+		if !ok {
+			change.Type = PackageAdded
+			add(change)
+			continue
+		}
+
+		if prevPkg.Skasowane != "TAK" && pkg.Skasowane == "TAK" {
+			withdrawn := change
+			withdrawn.Type = PackageWithdrawn
+			add(withdrawn)
+		} else if prevPkg.Skasowane == "TAK" && pkg.Skasowane != "TAK" {
+			restored := change
+			restored.Type = PackageRestored
+			add(restored)
+		}
+
+		if prevPkg.KodGTIN != pkg.KodGTIN {
+			gtin := change
+			gtin.Type = GtinChanged
+			gtin.OldValue = string(prevPkg.KodGTIN)
+			gtin.NewValue = string(pkg.KodGTIN)
+			add(gtin)
+		}
+
+		if prevPkg.KategoriaDostepnosci != pkg.KategoriaDostepnosci {
+			availability := change
+			availability.Type = AvailabilityChanged
+			availability.OldValue = string(prevPkg.KategoriaDostepnosci)
+			availability.NewValue = string(pkg.KategoriaDostepnosci)
+			add(availability)
+		}
+	}
+
+	for _, pkg := range packageList(previous) {
+		if !seen[packageKey(pkg)] {
+			change := packageBase
+			change.Type = PackageRemoved
+			change.PackageID = string(pkg.ID)
+			change.GTIN = string(pkg.KodGTIN)
+			add(change)
+		}
+	}
+}
+
+// addPackages reports a change of the given type for each active package of an added or removed product,
+// so that their GTINs are reported like those of packages added to or removed from existing products
+func addPackages(changeType string, product *model.ProduktLeczniczy, add func(Change)) {
+	base := productChange(changeType, product)
+	base.GTINs = nil
+	for _, pkg := range packageList(product) {
+		if pkg.Skasowane == "TAK" {
+			continue
+		}
+		change := base
+		change.PackageID = string(pkg.ID)
+		change.GTIN = string(pkg.KodGTIN)
+		add(change)
+	}
+}
+
+// productChange creates a change of the given type for a product
+func productChange(changeType string, product *model.ProduktLeczniczy) Change {
+	return Change{
+		Type:          changeType,
+		ProductID:     string(product.ID),
+		NazwaProduktu: string(product.NazwaProduktu),
+		KodyATC:       atcList(product),
+		GTINs:         gtinList(product),
+	}
+}
+
+// gtinList returns the GTINs of the packages of a product
+func gtinList(product *model.ProduktLeczniczy) []string {
+	var gtins []string
+	for _, pkg := range packageList(product) {
+		if pkg.KodGTIN != "" {
+			gtins = append(gtins, string(pkg.KodGTIN))
+		}
+	}
+	return gtins
+}
+
+// atcList returns the ATC codes of a product
+func atcList(product *model.ProduktLeczniczy) []string {
+	if product.KodyATC == nil {
+		return nil
+	}
+
+	codes := make([]string, len(product.KodyATC.KodATC))
+	for i, code := range product.KodyATC.KodATC {
+		codes[i] = string(code)
+	}
+	return codes
+}
+
+// atcCodes returns the ATC codes of a product as a comma separated list
+func atcCodes(product *model.ProduktLeczniczy) string {
+	return strings.Join(atcList(product), ",")
+}
+
+// packageList returns the packages of a product
+func packageList(product *model.ProduktLeczniczy) []*model.Opakowanie {
+	if product.Opakowania == nil {
+		return nil
+	}
+
+	list := make([]*model.Opakowanie, len(product.Opakowania.Opakowanie))
+	for i := range product.Opakowania.Opakowanie {
+		list[i] = &product.Opakowania.Opakowanie[i]
+	}
+	return list
+}
+
+// packages returns the packages of a product by their key
+func packages(product *model.ProduktLeczniczy) map[string]*model.Opakowanie {
+	byKey := make(map[string]*model.Opakowanie)
+	for _, pkg := range packageList(product) {
+		byKey[packageKey(pkg)] = pkg
+	}
+	return byKey
+}
+
+// packageKey identifies a package within a product
+func packageKey(pkg *model.Opakowanie) string {
+	if pkg.ID != "" {
+		return "id:" + string(pkg.ID)
+	}
+	return "gtin:" + string(pkg.KodGTIN)
+}
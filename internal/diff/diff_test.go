@@ -0,0 +1,183 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"gorpl/internal/model"
+)
+
+// product creates a product with an ATC code and packages
+func product(id, name, atc string, packages ...model.Opakowanie) model.ProduktLeczniczy {
+	product := model.ProduktLeczniczy{ID: model.BigIntAsString(id), NazwaProduktu: model.LimitedString(name)}
+	if atc != "" {
+		product.KodyATC = &model.KodyATC{KodATC: []model.LimitedString{model.LimitedString(atc)}}
+	}
+	if len(packages) > 0 {
+		product.Opakowania = &model.Opakowania{Opakowanie: packages}
+	}
+	return product
+}
+
+// pkg creates an active package available on prescription
+func pkg(id, gtin string) model.Opakowanie {
+	return model.Opakowanie{ID: model.BigIntAsString(id), KodGTIN: model.LimitedString(gtin), KategoriaDostepnosci: "Rp", Skasowane: "NIE"}
+}
+
+// withdrawn marks a package as withdrawn
+func withdrawn(pkg model.Opakowanie) model.Opakowanie {
+	pkg.Skasowane = "TAK"
+	return pkg
+}
+
+// summarize describes changes as type, product, package, GTIN and the changed values
+func summarize(changes []Change) []string {
+	var lines []string
+	for _, change := range changes {
+		lines = append(lines, fmt.Sprintf("%s %s/%s %s %s>%s", change.Type, change.ProductID, change.PackageID, change.GTIN, change.OldValue, change.NewValue))
+	}
+	return lines
+}
+
+func TestCompare(t *testing.T) {
+	apap := product("1", "Apap", "N02BE01", pkg("11", "05909990022427"), pkg("12", "05909990022434"))
+
+	tests := []struct {
+		name string
+		from []model.ProduktLeczniczy
+		to   []model.ProduktLeczniczy
+		want []string
+	}{
+		{
+			name: "no changes",
+			from: []model.ProduktLeczniczy{apap},
+			to:   []model.ProduktLeczniczy{apap},
+		},
+		{
+			name: "product added with its active packages",
+			to:   []model.ProduktLeczniczy{product("2", "Ibuprom", "M01AE01", pkg("21", "05909990335718"), withdrawn(pkg("22", "05909990335725")))},
+			want: []string{
+				"productAdded 2/  >",
+				"packageAdded 2/21 05909990335718 >",
+			},
+		},
+		{
+			name: "product removed with its active packages",
+			from: []model.ProduktLeczniczy{apap},
+			want: []string{
+				"productRemoved 1/  >",
+				"packageRemoved 1/11 05909990022427 >",
+				"packageRemoved 1/12 05909990022434 >",
+			},
+		},
+		{
+			name: "products are matched by ID",
+			from: []model.ProduktLeczniczy{apap, product("2", "Ibuprom", "")},
+			to:   []model.ProduktLeczniczy{product("2", "Ibuprom", ""), apap},
+		},
+		{
+			name: "rename",
+			from: []model.ProduktLeczniczy{apap},
+			to:   []model.ProduktLeczniczy{product("1", "Apap Extra", "N02BE01", pkg("11", "05909990022427"), pkg("12", "05909990022434"))},
+			want: []string{"productRenamed 1/  Apap>Apap Extra"},
+		},
+		{
+			name: "ATC change",
+			from: []model.ProduktLeczniczy{apap},
+			to:   []model.ProduktLeczniczy{product("1", "Apap", "N02BE51", pkg("11", "05909990022427"), pkg("12", "05909990022434"))},
+			want: []string{"atcChanged 1/  N02BE01>N02BE51"},
+		},
+		{
+			name: "package withdrawn",
+			from: []model.ProduktLeczniczy{apap},
+			to:   []model.ProduktLeczniczy{product("1", "Apap", "N02BE01", pkg("11", "05909990022427"), withdrawn(pkg("12", "05909990022434")))},
+			want: []string{"packageWithdrawn 1/12 05909990022434 >"},
+		},
+		{
+			name: "package restored",
+			from: []model.ProduktLeczniczy{product("1", "Apap", "N02BE01", withdrawn(pkg("11", "05909990022427")))},
+			to:   []model.ProduktLeczniczy{product("1", "Apap", "N02BE01", pkg("11", "05909990022427"))},
+			want: []string{"packageRestored 1/11 05909990022427 >"},
+		},
+		{
+			name: "GTIN change",
+			from: []model.ProduktLeczniczy{apap},
+			to:   []model.ProduktLeczniczy{product("1", "Apap", "N02BE01", pkg("11", "05909990022427"), pkg("12", "05909990335718"))},
+			want: []string{"gtinChanged 1/12 05909990335718 05909990022434>05909990335718"},
+		},
+		{
+			name: "availability change",
+			from: []model.ProduktLeczniczy{product("1", "Apap", "N02BE01", pkg("11", "05909990022427"))},
+			to: []model.ProduktLeczniczy{product("1", "Apap", "N02BE01", model.Opakowanie{
+				ID: "11", KodGTIN: "05909990022427", KategoriaDostepnosci: "OTC", Skasowane: "NIE",
+			})},
+			want: []string{"availabilityChanged 1/11 05909990022427 Rp>OTC"},
+		},
+		{
+			name: "packages added and removed",
+			from: []model.ProduktLeczniczy{apap},
+			to:   []model.ProduktLeczniczy{product("1", "Apap", "N02BE01", pkg("11", "05909990022427"), pkg("13", "05909990335718"))},
+			want: []string{
+				"packageAdded 1/13 05909990335718 >",
+				"packageRemoved 1/12 05909990022434 >",
+			},
+		},
+		{
+			name: "packages without an ID are matched by GTIN",
+			from: []model.ProduktLeczniczy{product("1", "Apap", "", pkg("", "05909990022427"), pkg("", "05909990022434"))},
+			to:   []model.ProduktLeczniczy{product("1", "Apap", "", withdrawn(pkg("", "05909990022434")), pkg("", "05909990335718"))},
+			want: []string{
+				"packageWithdrawn 1/ 05909990022434 >",
+				"packageAdded 1/ 05909990335718 >",
+				"packageRemoved 1/ 05909990022427 >",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		from := &model.ProduktyLecznicze{StanNaDzien: "2026-10-16", ProduktyLecznicze: test.from}
+		to := &model.ProduktyLecznicze{StanNaDzien: "2026-10-17", ProduktyLecznicze: test.to}
+
+		report := Compare(from, to)
+
+		if got := summarize(report.Changes); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: changes = %q, want %q", test.name, got, test.want)
+		}
+		if report.From != "2026-10-16" || report.To != "2026-10-17" {
+			t.Errorf("%s: report from %s to %s, want 2026-10-16 to 2026-10-17", test.name, report.From, report.To)
+		}
+		total := 0
+		for _, count := range report.Counts {
+			total += count
+		}
+		if total != len(report.Changes) {
+			t.Errorf("%s: counts %v add up to %d, want %d", test.name, report.Counts, total, len(report.Changes))
+		}
+	}
+}
+
+func TestCompareProductDetails(t *testing.T) {
+	from := &model.ProduktyLecznicze{}
+	to := &model.ProduktyLecznicze{ProduktyLecznicze: []model.ProduktLeczniczy{
+		product("1", "Apap", "N02BE01", pkg("11", "05909990022427"), withdrawn(pkg("12", "05909990022434")), pkg("13", "")),
+	}}
+
+	report := Compare(from, to)
+	if len(report.Changes) != 3 {
+		t.Fatalf("changes = %q, want the product and two active packages", summarize(report.Changes))
+	}
+
+	// Product level changes list the ATC codes and the GTINs of all packages
+	added := report.Changes[0]
+	if added.NazwaProduktu != "Apap" || !reflect.DeepEqual(added.KodyATC, []string{"N02BE01"}) ||
+		!reflect.DeepEqual(added.GTINs, []string{"05909990022427", "05909990022434"}) {
+		t.Errorf("product change = %+v, want Apap with its ATC code and GTINs", added)
+	}
+	// Package level changes carry the product but not the GTINs of its other packages
+	for _, change := range report.Changes[1:] {
+		if change.NazwaProduktu != "Apap" || change.GTINs != nil {
+			t.Errorf("package change = %+v, want Apap without GTINs", change)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Package gs1 contains code for validating and normalizing GS1 trade item numbers (GTIN)
+package gs1
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Length is the length of normalized GTINs, shorter GTINs are padded with leading zeros to GTIN-14
+const Length = 14
+
+var (
+	// ErrInvalidGtin is returned for codes which are not 8, 12, 13 or 14 digits long
+	ErrInvalidGtin = errors.New("invalid GTIN")
+	// ErrInvalidCheckDigit is returned for codes of a valid length with a wrong check digit
+	ErrInvalidCheckDigit = errors.New("invalid GTIN check digit")
+)
+
+// CheckDigit computes the check digit of the digits of a GTIN without its check digit
+// Digits are weighted 3 and 1 alternately from the right
+func CheckDigit(digits string) byte {
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i -= 2 {
+		sum += 3 * int(digits[i]-'0')
+		if i > 0 {
+			sum += int(digits[i-1] - '0')
+		}
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// Normalize validates a GTIN-8, GTIN-12 (UPC-A), GTIN-13 (EAN-13) or GTIN-14 and returns it as GTIN-14
+// Surrounding whitespace is ignored, so the same item scanned in different formats has the same key
+func Normalize(code string) (string, error) {
+	code = strings.TrimSpace(code)
+
+	switch len(code) {
+	case 8, 12, 13, 14:
+	default:
+		return "", fmt.Errorf("%w: %q has to have 8, 12, 13 or 14 digits", ErrInvalidGtin, code)
+	}
+	for i := 0; i < len(code); i++ {
+		if code[i] < '0' || code[i] > '9' {
+			return "", fmt.Errorf("%w: %q has to have 8, 12, 13 or 14 digits", ErrInvalidGtin, code)
+		}
+	}
+
+	if expected := CheckDigit(code[:len(code)-1]); code[len(code)-1] != expected {
+		return "", fmt.Errorf("%w: %q should end with %c", ErrInvalidCheckDigit, code, expected)
+	}
+
+	return strings.Repeat("0", Length-len(code)) + code, nil
+}
+
+// Equal reports whether two codes are the same GTIN, codes which are not valid GTINs are compared as they are
+func Equal(a, b string) bool {
+	return Key(a) == Key(b)
+}
+
+// Key returns the normalized GTIN-14 of a valid code or the code without surrounding whitespace otherwise
+// It is used to index codes from the registry, which may contain invalid GTINs
+func Key(code string) string {
+	if normalized, err := Normalize(code); err == nil {
+		return normalized
+	}
+	return strings.TrimSpace(code)
+}
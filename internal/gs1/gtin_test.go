@@ -0,0 +1,100 @@
+package gs1
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckDigit(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   byte
+	}{
+		{"9638507", '4'},
+		{"03600029145", '2'},
+		{"590999002242", '7'},
+		{"1003600029145", '9'},
+		{"0000000", '0'},
+	}
+
+	for _, test := range tests {
+		if got := CheckDigit(test.digits); got != test.want {
+			t.Errorf("CheckDigit(%q) = %c, want %c", test.digits, got, test.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want string
+		err  error
+	}{
+		{"GTIN-8", "96385074", "00000096385074", nil},
+		{"GTIN-12", "036000291452", "00036000291452", nil},
+		{"GTIN-13", "5909990022427", "05909990022427", nil},
+		{"GTIN-14", "10036000291459", "10036000291459", nil},
+		{"padded GTIN-14", "05909990022427", "05909990022427", nil},
+		{"surrounding whitespace", " 5909990022427\n", "05909990022427", nil},
+		{"bad check digit", "5909990022428", "", ErrInvalidCheckDigit},
+		{"bad check digit GTIN-8", "96385075", "", ErrInvalidCheckDigit},
+		{"letters", "590999002242A", "", ErrInvalidGtin},
+		{"inner space", "590999 022427", "", ErrInvalidGtin},
+		{"too short", "1234567", "", ErrInvalidGtin},
+		{"GTIN-10 length", "1234567890", "", ErrInvalidGtin},
+		{"too long", "059099900224270", "", ErrInvalidGtin},
+		{"empty", "", "", ErrInvalidGtin},
+	}
+
+	for _, test := range tests {
+		got, err := Normalize(test.code)
+		if !errors.Is(err, test.err) || (test.err == nil && err != nil) {
+			t.Errorf("%s: Normalize(%q) error = %v, want %v", test.name, test.code, err, test.err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: Normalize(%q) = %q, want %q", test.name, test.code, got, test.want)
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"5909990022427", "05909990022427", true},
+		{"036000291452", "0036000291452", true},
+		{"96385074", "00000096385074", true},
+		{"5909990022427", "5909990022434", false},
+		// Invalid codes are only equal to themselves
+		{"5909990022428", "5909990022428", true},
+		{"5909990022428", "05909990022428", false},
+		{"ABC", " ABC ", true},
+	}
+
+	for _, test := range tests {
+		if got := Equal(test.a, test.b); got != test.want {
+			t.Errorf("Equal(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"5909990022427", "05909990022427"},
+		{"96385074", "00000096385074"},
+		{" 5909990022428 ", "5909990022428"},
+		{"ABC", "ABC"},
+	}
+
+	for _, test := range tests {
+		if got := Key(test.code); got != test.want {
+			t.Errorf("Key(%q) = %q, want %q", test.code, got, test.want)
+		}
+	}
+}
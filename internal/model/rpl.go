@@ -13,6 +13,16 @@ type DateAsString string     // max length 10
 type DeletedAsString string  // "Skasowane", ""
 type ChangeTypeString string // "Nowy", "Zmodyfikowany", "Usuniety"
 
+// Product statuses in incremental registry exports
+const (
+	StatusNowy          ChangeTypeString = "Nowy"
+	StatusZmodyfikowany ChangeTypeString = "Zmodyfikowany"
+	StatusUsuniety      ChangeTypeString = "Usuniety"
+)
+
+// Namespace is the XML namespace of the registry export
+const Namespace = "http://rejestry.ezdrowie.gov.pl/rpl/eksport-danych-v6.0.0"
+
 // Main structures based on schematXmlRejestr_Produktow_Leczniczych.xsd
 type ProduktyLecznicze struct {
 	XMLName           xml.Name           `xml:"http://rejestry.ezdrowie.gov.pl/rpl/eksport-danych-v6.0.0 produktyLecznicze"`
@@ -0,0 +1,178 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gorpl/internal/database"
+)
+
+const (
+	// quarantineDir is the directory inside the data directory where rejected snapshots are moved
+	quarantineDir = "quarantine"
+	// activeSummaryFile is the name of the file that stores the summary of the active data
+	activeSummaryFile = ".active-summary.json"
+)
+
+// ActivationPolicy describes checks a new snapshot has to pass before it replaces the active data
+// Zero values disable the respective check
+type ActivationPolicy struct {
+	MinProducts int
+	// Maximum allowed drop compared to the active snapshot, in percent
+	MaxProductDrop float64
+	MaxGtinDrop    float64
+}
+
+// Rejection describes a snapshot that failed the activation checks
+type Rejection struct {
+	Name        string    `json:"name"`
+	Reasons     []string  `json:"reasons"`
+	RejectedAt  time.Time `json:"rejectedAt"`
+	StanNaDzien string    `json:"stanNaDzien"`
+	Products    int       `json:"products"`
+	GtinEntries int       `json:"gtinEntries"`
+	// Whether the file is an incremental export
+	Delta bool `json:"delta,omitempty"`
+}
+
+// Check compares a new snapshot with the active one and returns the reasons to reject it
+// An empty active summary means there is no data to compare with
+func (p ActivationPolicy) Check(active, next database.Summary) []string {
+	var reasons []string
+
+	if p.MinProducts > 0 && next.Products < p.MinProducts {
+		reasons = append(reasons, fmt.Sprintf("only %d products, at least %d required", next.Products, p.MinProducts))
+	}
+	if drop := percentDrop(active.Products, next.Products); p.MaxProductDrop > 0 && drop > p.MaxProductDrop {
+		reasons = append(reasons, fmt.Sprintf("product count dropped by %.1f%% (%d -> %d), at most %.1f%% allowed",
+			drop, active.Products, next.Products, p.MaxProductDrop))
+	}
+	if drop := percentDrop(active.GtinEntries, next.GtinEntries); p.MaxGtinDrop > 0 && drop > p.MaxGtinDrop {
+		reasons = append(reasons, fmt.Sprintf("GTIN index dropped by %.1f%% (%d -> %d), at most %.1f%% allowed",
+			drop, active.GtinEntries, next.GtinEntries, p.MaxGtinDrop))
+	}
+	// Dates are in YYYY-MM-DD format, so they compare lexically
+	if active.StanNaDzien != "" && next.StanNaDzien < active.StanNaDzien {
+		reasons = append(reasons, fmt.Sprintf("stanNaDzien %q is older than the active %q", next.StanNaDzien, active.StanNaDzien))
+	}
+
+	return reasons
+}
+
+// SaveActiveSummary records the summary of the active data in the data directory,
+// so that a snapshot downloaded at the next start can be checked without loading the previous one
+func (c Config) SaveActiveSummary(summary database.Summary) error {
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("error encoding active summary: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(c.DataDir, activeSummaryFile), data, 0644); err != nil {
+		return fmt.Errorf("error saving active summary: %w", err)
+	}
+	return nil
+}
+
+// ActiveSummary returns the summary recorded by SaveActiveSummary
+// A missing or broken file results in an empty summary, which disables the comparison
+func (c Config) ActiveSummary() database.Summary {
+	var summary database.Summary
+
+	data, err := os.ReadFile(filepath.Join(c.DataDir, activeSummaryFile))
+	if err != nil {
+		return summary
+	}
+	if err := json.Unmarshal(data, &summary); err != nil {
+		log.Printf("Ignoring invalid active summary: %v", err)
+		return database.Summary{}
+	}
+	return summary
+}
+
+// percentDrop returns by how many percent next is lower than previous
+func percentDrop(previous, next int) float64 {
+	if previous == 0 || next >= previous {
+		return 0
+	}
+	return float64(previous-next) * 100 / float64(previous)
+}
+
+// Quarantine moves a rejected snapshot out of the data directory and records why it was rejected
+// A rejected download is not downloaded again until the registry serves a different file
+func Quarantine(filePath string, summary database.Summary, reasons []string) error {
+	if err := quarantineAs(filePath, filepath.Base(filePath), summary, reasons); err != nil {
+		return err
+	}
+	if err := rejectDownload(filePath); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	return nil
+}
+
+// quarantineAs moves a rejected file to the quarantine directory next to it under the given name
+func quarantineAs(filePath, name string, summary database.Summary, reasons []string) error {
+	dir := filepath.Join(filepath.Dir(filePath), quarantineDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("cannot create quarantine directory: %w", err)
+	}
+
+	if err := os.Rename(filePath, filepath.Join(dir, name)); err != nil {
+		return fmt.Errorf("cannot move file to quarantine: %w", err)
+	}
+	os.Remove(database.CacheFile(filePath))
+
+	data, err := json.MarshalIndent(Rejection{
+		Name:        name,
+		Reasons:     reasons,
+		RejectedAt:  time.Now(),
+		StanNaDzien: summary.StanNaDzien,
+		Products:    summary.Products,
+		GtinEntries: summary.GtinEntries,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding rejection: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".json"), data, 0644); err != nil {
+		return fmt.Errorf("error saving rejection: %w", err)
+	}
+
+	log.Printf("Quarantined %s: %v", name, reasons)
+	return nil
+}
+
+// Rejections returns snapshots and incremental exports quarantined in dataDir, most recently rejected first
+func Rejections(dataDir string) ([]Rejection, error) {
+	rejections := []Rejection{}
+	for _, dir := range []string{dataDir, filepath.Join(dataDir, deltaDir)} {
+		files, err := filepath.Glob(filepath.Join(dir, quarantineDir, "*.json"))
+		if err != nil {
+			return nil, fmt.Errorf("error reading quarantine directory: %w", err)
+		}
+
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				log.Printf("Error reading %s: %v", file, err)
+				continue
+			}
+			var rejection Rejection
+			if err := json.Unmarshal(data, &rejection); err != nil {
+				log.Printf("Error decoding %s: %v", file, err)
+				continue
+			}
+			// Incremental exports have the same names as snapshots
+			rejection.Delta = dir != dataDir
+			rejections = append(rejections, rejection)
+		}
+	}
+
+	sort.Slice(rejections, func(i, j int) bool {
+		return rejections[i].RejectedAt.After(rejections[j].RejectedAt)
+	})
+
+	return rejections, nil
+}
@@ -0,0 +1,175 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gorpl/internal/database"
+)
+
+func TestActivationPolicyCheck(t *testing.T) {
+	policy := ActivationPolicy{MinProducts: 100, MaxProductDrop: 10, MaxGtinDrop: 20}
+	active := database.Summary{StanNaDzien: "2026-10-16", Products: 1000, GtinEntries: 2000}
+
+	tests := []struct {
+		name    string
+		policy  ActivationPolicy
+		active  database.Summary
+		next    database.Summary
+		reasons int
+	}{
+		{"same data", policy, active, active, 0},
+		{"newer and larger", policy, active, database.Summary{StanNaDzien: "2026-10-17", Products: 1100, GtinEntries: 2100}, 0},
+		{"drop within limits", policy, active, database.Summary{StanNaDzien: "2026-10-17", Products: 900, GtinEntries: 1600}, 0},
+		{"too few products", policy, database.Summary{}, database.Summary{Products: 99}, 1},
+		{"product drop", policy, active, database.Summary{StanNaDzien: "2026-10-17", Products: 899, GtinEntries: 2000}, 1},
+		{"GTIN drop", policy, active, database.Summary{StanNaDzien: "2026-10-17", Products: 1000, GtinEntries: 1599}, 1},
+		{"older export", policy, active, database.Summary{StanNaDzien: "2026-10-15", Products: 1000, GtinEntries: 2000}, 1},
+		{"empty export", policy, active, database.Summary{}, 4},
+		{"nothing to compare with", policy, database.Summary{}, database.Summary{StanNaDzien: "2026-10-17", Products: 100}, 0},
+		{"checks disabled", ActivationPolicy{}, active, database.Summary{Products: 1}, 1},
+	}
+
+	for _, test := range tests {
+		if reasons := test.policy.Check(test.active, test.next); len(reasons) != test.reasons {
+			t.Errorf("%s: Check = %q, want %d reasons", test.name, reasons, test.reasons)
+		}
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	config := testConfig(t)
+	filePath := daysAgo(config, 0)
+	writeSnapshot(t, filePath, "2026-10-17", 1)
+	writeFile(t, database.CacheFile(filePath), "cache")
+	if err := saveDownloadState(config.DataDir, downloadState{ETag: `"v1"`, File: filepath.Base(filePath)}); err != nil {
+		t.Fatal(err)
+	}
+
+	summary := database.Summary{StanNaDzien: "2026-10-17", Products: 1, GtinEntries: 1}
+	if err := Quarantine(filePath, summary, []string{"too small"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+		t.Errorf("rejected file is still in the data directory: %v", err)
+	}
+	if _, err := os.Stat(database.CacheFile(filePath)); !os.IsNotExist(err) {
+		t.Errorf("cache of the rejected file was kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(config.DataDir, quarantineDir, filepath.Base(filePath))); err != nil {
+		t.Errorf("rejected file is not in quarantine: %v", err)
+	}
+	if state := loadDownloadState(config.DataDir); state.RejectedETag != `"v1"` || state.File != "" {
+		t.Errorf("download state = %+v, want the rejected validators only", state)
+	}
+
+	// Incremental exports are quarantined next to them
+	deltaPath := filepath.Join(config.DataDir, deltaDir, filepath.Base(filePath))
+	if err := os.MkdirAll(filepath.Dir(deltaPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeSnapshot(t, deltaPath, "2026-10-17", 1)
+	if err := Quarantine(deltaPath, summary, []string{"older export"}); err != nil {
+		t.Fatal(err)
+	}
+
+	rejections, err := Rejections(config.DataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rejections) != 2 {
+		t.Fatalf("Rejections returned %d rejections, want 2", len(rejections))
+	}
+	// Most recently rejected first
+	if !rejections[0].Delta || rejections[0].Reasons[0] != "older export" {
+		t.Errorf("first rejection = %+v, want the incremental export", rejections[0])
+	}
+	if rejections[1].Delta || rejections[1].Name != filepath.Base(filePath) || rejections[1].Products != 1 {
+		t.Errorf("second rejection = %+v, want the snapshot", rejections[1])
+	}
+}
+
+func TestRefreshRejectsSnapshot(t *testing.T) {
+	config := testConfig(t)
+	yesterday, today := daysAgo(config, 1), daysAgo(config, 0)
+	writeSnapshot(t, yesterday, "2026-10-16", 10)
+
+	requests := 0
+	refresher := newTestRefresher(t, config, yesterday, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"small"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"small"`)
+		fmt.Fprint(w, snapshotXML("2026-10-17", 5))
+	})
+
+	err := refresher.Refresh()
+	if !errors.Is(err, ErrSnapshotRejected) {
+		t.Fatalf("Refresh error = %v, want %v", err, ErrSnapshotRejected)
+	}
+	status := refresher.Status()
+	if status.SourceFile != yesterday || status.Products != 10 || !status.Stale {
+		t.Errorf("status = %+v, want the stale data from %s", status, yesterday)
+	}
+	if _, err := os.Stat(today); !os.IsNotExist(err) {
+		t.Errorf("rejected snapshot was kept in the data directory: %v", err)
+	}
+
+	// The same export is not downloaded again
+	if err := refresher.Refresh(); !errors.Is(err, ErrRejectedUnchanged) {
+		t.Errorf("second Refresh error = %v, want %v", err, ErrRejectedUnchanged)
+	}
+	if requests != 2 {
+		t.Errorf("%d requests, want 2", requests)
+	}
+}
+
+func TestRefreshActivatesSnapshot(t *testing.T) {
+	config := testConfig(t)
+	yesterday, today := daysAgo(config, 1), daysAgo(config, 0)
+	writeSnapshot(t, yesterday, "2026-10-16", 10)
+
+	refresher := newTestRefresher(t, config, yesterday, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, snapshotXML("2026-10-17", 11))
+	})
+
+	if err := refresher.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	status := refresher.Status()
+	if status.SourceFile != today || status.Products != 11 || status.Stale {
+		t.Errorf("status = %+v, want 11 products from %s", status, today)
+	}
+
+	// The summary of the active data is kept for the next start
+	if summary := config.ActiveSummary(); summary.SourceFile != today || summary.Products != 11 || summary.StanNaDzien != "2026-10-17" {
+		t.Errorf("active summary = %+v, want the summary of %s", summary, today)
+	}
+}
+
+func TestActiveSummary(t *testing.T) {
+	config := testConfig(t)
+	if summary := config.ActiveSummary(); summary != (database.Summary{}) {
+		t.Errorf("ActiveSummary without a file = %+v, want an empty summary", summary)
+	}
+
+	want := database.Summary{StanNaDzien: "2026-10-17", Products: 5, GtinEntries: 6, SourceFile: "data/20261017_6.0.0.xml", Checksum: "abc"}
+	if err := config.SaveActiveSummary(want); err != nil {
+		t.Fatal(err)
+	}
+	if summary := config.ActiveSummary(); summary != want {
+		t.Errorf("ActiveSummary = %+v, want %+v", summary, want)
+	}
+
+	writeFile(t, filepath.Join(config.DataDir, activeSummaryFile), "{")
+	if summary := config.ActiveSummary(); summary != (database.Summary{}) {
+		t.Errorf("ActiveSummary of a broken file = %+v, want an empty summary", summary)
+	}
+}
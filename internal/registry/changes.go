@@ -0,0 +1,106 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gorpl/internal/diff"
+)
+
+// ErrComparisonInProgress is returned when another snapshot is already being compared with the current data
+var ErrComparisonInProgress = errors.New("comparison already in progress")
+
+// diffCache keeps reports comparing stored snapshots with the current data
+// Comparing requires loading a whole snapshot, so only one comparison runs at a time
+// and further requests are rejected until it is done
+type diffCache struct {
+	// Held while a snapshot is loaded for a comparison
+	comparing sync.Mutex
+	// Protects the fields below
+	mutex sync.Mutex
+	// Checksum of the data the reports were made for
+	checksum string
+	reports  map[string]*diff.Report
+}
+
+// get returns the cached report for a snapshot compared with the data with the given checksum
+func (d *diffCache) get(snapshot, checksum string) *diff.Report {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.checksum != checksum {
+		d.checksum = checksum
+		d.reports = make(map[string]*diff.Report)
+	}
+	return d.reports[snapshot]
+}
+
+// put caches a report, unless the data has changed in the meantime
+func (d *diffCache) put(snapshot, checksum string, report *diff.Report) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.checksum == checksum {
+		d.reports[snapshot] = report
+	}
+}
+
+// ChangesSince compares the snapshot that was current on the given day with the current data
+// ErrComparisonInProgress is returned while another snapshot is being compared
+func (r *Refresher) ChangesSince(since time.Time) (*diff.Report, error) {
+	snapshots, err := r.config.Snapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	// Snapshots are sorted newest first
+	var snapshot string
+	for _, candidate := range snapshots {
+		date, err := r.config.snapshotDate(candidate)
+		if err == nil && !date.After(since) {
+			snapshot = candidate
+			break
+		}
+	}
+	if snapshot == "" {
+		return nil, fmt.Errorf("%w: no snapshot from %s or earlier", ErrSnapshotNotFound, since.Format("2006-01-02"))
+	}
+
+	current := r.db.Produkty()
+	summary := r.db.Summary()
+	if current == nil {
+		return nil, fmt.Errorf("no data loaded")
+	}
+
+	if report := r.diffs.get(snapshot, summary.Checksum); report != nil {
+		return report, nil
+	}
+
+	if !r.diffs.comparing.TryLock() {
+		return nil, ErrComparisonInProgress
+	}
+	defer r.diffs.comparing.Unlock()
+
+	// Another request may have made the report in the meantime
+	if report := r.diffs.get(snapshot, summary.Checksum); report != nil {
+		return report, nil
+	}
+
+	// Old snapshots are only loaded for the comparison, they do not need a cache
+	previous := r.db.NewEmpty()
+	previous.SetProgressFunc(nil)
+	previous.SetCacheEnabled(false)
+	if err := previous.LoadFromFile(snapshot); err != nil {
+		return nil, fmt.Errorf("error loading %s: %w", filepath.Base(snapshot), err)
+	}
+
+	report := diff.Compare(previous.Produkty(), current)
+	report.FromFile = filepath.Base(snapshot)
+	report.ToFile = filepath.Base(summary.SourceFile)
+	r.diffs.put(snapshot, summary.Checksum, report)
+
+	return report, nil
+}
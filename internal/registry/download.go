@@ -0,0 +1,372 @@
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorpl/internal/database"
+)
+
+// downloadStateFile is the name of the file that stores validators of the last download
+const downloadStateFile = ".download-state.json"
+
+// errNotRetryable marks download errors that will not go away when retried
+var errNotRetryable = errors.New("not retryable")
+
+// ErrNotModified is returned by DownloadUpdate when the file has not changed since the last download
+var ErrNotModified = errors.New("file has not changed")
+
+// ErrRejectedUnchanged is returned when the registry still serves a file rejected by the activation checks
+var ErrRejectedUnchanged = errors.New("registry has not changed since the rejected download")
+
+// Downloader downloads registry files using conditional and resumable requests
+type Downloader struct {
+	Client     *http.Client
+	MaxRetries int
+	RetryDelay time.Duration
+}
+
+// HTTPConfig configures the HTTP client used for downloads
+type HTTPConfig struct {
+	// Timeout of a whole request including reading the body
+	Timeout        time.Duration
+	ConnectTimeout time.Duration
+	// Proxy URL, proxy settings from the environment are used when empty
+	Proxy string
+	// Path to a PEM file with additional trusted CA certificates
+	CABundle string
+}
+
+// downloadState holds validators needed for conditional and resumed requests
+type downloadState struct {
+	// Validators of the last complete download
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	File         string `json:"file,omitempty"`
+	// Validator of the partially written temporary file
+	PartialValidator string `json:"partialValidator,omitempty"`
+	// Validators of a download rejected by the activation checks, it is not downloaded again
+	RejectedETag         string `json:"rejectedETag,omitempty"`
+	RejectedLastModified string `json:"rejectedLastModified,omitempty"`
+}
+
+// NewHTTPClient creates an HTTP client according to the configuration
+func NewHTTPClient(config HTTPConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if config.ConnectTimeout > 0 {
+		transport.DialContext = (&net.Dialer{Timeout: config.ConnectTimeout, KeepAlive: 30 * time.Second}).DialContext
+		transport.TLSHandshakeTimeout = config.ConnectTimeout
+	}
+
+	if config.Proxy != "" {
+		proxyURL, err := url.Parse(config.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if config.CABundle != "" {
+		pem, err := os.ReadFile(config.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", config.CABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &http.Client{Transport: transport, Timeout: config.Timeout}, nil
+}
+
+// NewDownloader creates a new Downloader using the given HTTP client
+func NewDownloader(client *http.Client, maxRetries int) *Downloader {
+	return &Downloader{
+		Client:     client,
+		MaxRetries: maxRetries,
+		RetryDelay: 2 * time.Second,
+	}
+}
+
+// Download downloads the XML file from sourceURL to filePath, retrying with exponential backoff
+// When the file has not changed since the last download, the previous file is linked or copied to filePath
+func (d *Downloader) Download(sourceURL, filePath string) error {
+	return d.retry(sourceURL, filePath, true)
+}
+
+// DownloadUpdate downloads a file like Download, but returns ErrNotModified when it has not changed,
+// keeping the previous file under its name. Incremental exports must not be applied twice.
+func (d *Downloader) DownloadUpdate(sourceURL, filePath string) error {
+	return d.retry(sourceURL, filePath, false)
+}
+
+// retry downloads a file, retrying with exponential backoff
+// With reuse set, an unchanged file is linked or copied to filePath
+func (d *Downloader) retry(sourceURL, filePath string, reuse bool) error {
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("cannot create directory: %w", err)
+	}
+
+	delay := d.RetryDelay
+	var err error
+	for attempt := 0; attempt <= d.MaxRetries; attempt++ {
+		if attempt > 0 {
+			log.Printf("Retrying download in %v (attempt %d of %d)...", delay, attempt, d.MaxRetries)
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		err = d.download(sourceURL, filePath, reuse)
+		if err == nil {
+			break
+		}
+		log.Printf("Download failed: %v", err)
+		if errors.Is(err, errNotRetryable) {
+			return err
+		}
+	}
+	return err
+}
+
+// download performs a single download attempt
+func (d *Downloader) download(sourceURL, filePath string, reuse bool) error {
+	dir := filepath.Dir(filePath)
+	state := loadDownloadState(dir)
+	tempFile := filePath + ".tmp"
+
+	req, err := http.NewRequest(http.MethodGet, sourceURL, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w (%w)", err, errNotRetryable)
+	}
+
+	// Ask only for changes when the previous snapshot is still around
+	previousFile := ""
+	if state.File != "" {
+		previousFile = filepath.Join(dir, state.File)
+		if _, err := os.Stat(previousFile); err == nil {
+			if state.ETag != "" {
+				req.Header.Set("If-None-Match", state.ETag)
+			}
+			if state.LastModified != "" {
+				req.Header.Set("If-Modified-Since", state.LastModified)
+			}
+		} else {
+			previousFile = ""
+		}
+	}
+
+	// Do not download a rejected file again until the registry changes
+	rejected := previousFile == "" && (state.RejectedETag != "" || state.RejectedLastModified != "")
+	if rejected {
+		if state.RejectedETag != "" {
+			req.Header.Set("If-None-Match", state.RejectedETag)
+		}
+		if state.RejectedLastModified != "" {
+			req.Header.Set("If-Modified-Since", state.RejectedLastModified)
+		}
+	}
+
+	// Resume a partially written file
+	var offset int64
+	if info, err := os.Stat(tempFile); err == nil && info.Size() > 0 && state.PartialValidator != "" {
+		offset = info.Size()
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", state.PartialValidator)
+	}
+
+	log.Printf("Downloading file from %s...", sourceURL)
+	startTime := time.Now()
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error downloading: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var out *os.File
+	switch {
+	case resp.StatusCode == http.StatusNotModified && previousFile != "" && !reuse:
+		return fmt.Errorf("%w since %s (%w)", ErrNotModified, state.File, errNotRetryable)
+	case resp.StatusCode == http.StatusNotModified && previousFile != "":
+		log.Printf("Registry has not changed since %s, reusing it", state.File)
+		if previousFile != filePath {
+			// The previous snapshot stays in the history under its own date
+			if err := linkOrCopy(previousFile, filePath); err != nil {
+				return fmt.Errorf("cannot reuse file: %w", err)
+			}
+			// The cache is still valid for the same content
+			if err := linkOrCopy(database.CacheFile(previousFile), database.CacheFile(filePath)); err != nil && !os.IsNotExist(err) {
+				log.Printf("Warning: cannot reuse cache: %v", err)
+			}
+		}
+		state.File = filepath.Base(filePath)
+		return saveDownloadState(dir, state)
+	case resp.StatusCode == http.StatusNotModified && rejected:
+		return fmt.Errorf("%w (%w)", ErrRejectedUnchanged, errNotRetryable)
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			os.Remove(tempFile)
+			return fmt.Errorf("unexpected Content-Range: %q", resp.Header.Get("Content-Range"))
+		}
+		log.Printf("Resuming download at %d bytes", offset)
+		out, err = os.OpenFile(tempFile, os.O_WRONLY|os.O_APPEND, 0644)
+	case resp.StatusCode == http.StatusOK:
+		offset = 0
+		out, err = os.Create(tempFile)
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is complete or stale, start over without a range
+		os.Remove(tempFile)
+		state.PartialValidator = ""
+		if err := saveDownloadState(dir, state); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+		return fmt.Errorf("cannot resume download at %d bytes: HTTP status %d", offset, resp.StatusCode)
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("invalid HTTP status: %d", resp.StatusCode)
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return fmt.Errorf("invalid HTTP status: %d (%w)", resp.StatusCode, errNotRetryable)
+	default:
+		return fmt.Errorf("invalid HTTP status: %d", resp.StatusCode)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot create temporary file: %w", err)
+	}
+	defer out.Close()
+
+	// Remember how to resume this file in case the connection drops
+	state.PartialValidator = resp.Header.Get("ETag")
+	if state.PartialValidator == "" {
+		state.PartialValidator = resp.Header.Get("Last-Modified")
+	}
+	if err := saveDownloadState(dir, state); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	n, err := io.Copy(out, resp.Body)
+	if err != nil {
+		return fmt.Errorf("error saving data after %d bytes: %w", offset+n, err)
+	}
+
+	out.Close()
+
+	if err := os.Rename(tempFile, filePath); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("cannot rename file: %w", err)
+	}
+
+	log.Printf("Downloaded %d bytes in %v", offset+n, time.Since(startTime))
+
+	return saveDownloadState(dir, downloadState{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		File:         filepath.Base(filePath),
+	})
+}
+
+// linkOrCopy makes the content of src available as dst, replacing dst
+// A hard link is used when possible, the file is copied otherwise
+func linkOrCopy(src, dst string) error {
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+	os.Remove(dst)
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tempFile := dst + ".tmp"
+	out, err := os.Create(tempFile)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tempFile)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tempFile)
+		return err
+	}
+	return os.Rename(tempFile, dst)
+}
+
+// rejectDownload records that a downloaded file was rejected, so that it is not downloaded again
+// Files which are not the last download are ignored
+func rejectDownload(filePath string) error {
+	dir := filepath.Dir(filePath)
+	state := loadDownloadState(dir)
+	if state.File == "" || state.File != filepath.Base(filePath) {
+		return nil
+	}
+
+	state.RejectedETag, state.RejectedLastModified = state.ETag, state.LastModified
+	state.ETag, state.LastModified, state.File = "", "", ""
+	return saveDownloadState(dir, state)
+}
+
+// forgetDownload removes the validators of a downloaded file replaced by other content, e.g. an upload,
+// so that an unchanged registry is not mistaken for it
+func forgetDownload(filePath string) error {
+	dir := filepath.Dir(filePath)
+	state := loadDownloadState(dir)
+	if state.File == "" || state.File != filepath.Base(filePath) {
+		return nil
+	}
+
+	state.ETag, state.LastModified, state.File = "", "", ""
+	return saveDownloadState(dir, state)
+}
+
+// loadDownloadState reads the download state from the data directory
+// A missing or broken state file results in an empty state
+func loadDownloadState(dir string) downloadState {
+	var state downloadState
+
+	data, err := os.ReadFile(filepath.Join(dir, downloadStateFile))
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Printf("Ignoring invalid download state: %v", err)
+		return downloadState{}
+	}
+	return state
+}
+
+// saveDownloadState writes the download state to the data directory
+func saveDownloadState(dir string, state downloadState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("error encoding download state: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, downloadStateFile), data, 0644); err != nil {
+		return fmt.Errorf("error saving download state: %w", err)
+	}
+	return nil
+}
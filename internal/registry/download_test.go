@@ -0,0 +1,349 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gorpl/internal/database"
+)
+
+// testBody is the content served by the test registry
+const testBody = "<produktyLecznicze>registry export</produktyLecznicze>"
+
+// serveBody writes testBody, or the part of it requested with a matching If-Range, like a static file server
+func serveBody(w http.ResponseWriter, r *http.Request, etag string) {
+	w.Header().Set("ETag", etag)
+	var offset int
+	if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &offset); err == nil && r.Header.Get("If-Range") == etag {
+		if offset >= len(testBody) {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(testBody)-1, len(testBody)))
+		w.WriteHeader(http.StatusPartialContent)
+		fmt.Fprint(w, testBody[offset:])
+		return
+	}
+	fmt.Fprint(w, testBody)
+}
+
+func TestDownload(t *testing.T) {
+	tests := []struct {
+		name string
+		// Download state and files present before the download
+		state    downloadState
+		previous bool
+		partial  string
+		update   bool
+		// Handler of the n-th request, starting with 1
+		handler  func(w http.ResponseWriter, r *http.Request, n int)
+		requests int
+		// Expected content of the downloaded file, empty when it must not exist
+		want string
+		err  error
+		// Any error is expected
+		fails bool
+	}{
+		{
+			name: "full download",
+			handler: func(w http.ResponseWriter, r *http.Request, n int) {
+				serveBody(w, r, `"v1"`)
+			},
+			requests: 1,
+			want:     testBody,
+		},
+		{
+			name:     "not modified",
+			state:    downloadState{ETag: `"v1"`, File: "yesterday.xml"},
+			previous: true,
+			handler: func(w http.ResponseWriter, r *http.Request, n int) {
+				if r.Header.Get("If-None-Match") == `"v1"` {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				fmt.Fprint(w, "changed")
+			},
+			requests: 1,
+			want:     testBody,
+		},
+		{
+			name:     "not modified since",
+			state:    downloadState{LastModified: "Fri, 16 Oct 2026 06:00:00 GMT", File: "yesterday.xml"},
+			previous: true,
+			handler: func(w http.ResponseWriter, r *http.Request, n int) {
+				if r.Header.Get("If-Modified-Since") == "Fri, 16 Oct 2026 06:00:00 GMT" {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				fmt.Fprint(w, "changed")
+			},
+			requests: 1,
+			want:     testBody,
+		},
+		{
+			name:     "modified",
+			state:    downloadState{ETag: `"v0"`, File: "yesterday.xml"},
+			previous: true,
+			handler: func(w http.ResponseWriter, r *http.Request, n int) {
+				w.Header().Set("ETag", `"v1"`)
+				fmt.Fprint(w, "changed")
+			},
+			requests: 1,
+			want:     "changed",
+		},
+		{
+			name:     "previous file is gone",
+			state:    downloadState{ETag: `"v1"`, File: "yesterday.xml"},
+			previous: false,
+			handler: func(w http.ResponseWriter, r *http.Request, n int) {
+				if r.Header.Get("If-None-Match") != "" {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				serveBody(w, r, `"v1"`)
+			},
+			requests: 1,
+			want:     testBody,
+		},
+		{
+			name:    "resume",
+			state:   downloadState{PartialValidator: `"v1"`},
+			partial: testBody[:10],
+			handler: func(w http.ResponseWriter, r *http.Request, n int) {
+				if r.Header.Get("Range") != "bytes=10-" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				serveBody(w, r, `"v1"`)
+			},
+			requests: 1,
+			want:     testBody,
+		},
+		{
+			name:    "resume of a changed file",
+			state:   downloadState{PartialValidator: `"v0"`},
+			partial: "stale part",
+			handler: func(w http.ResponseWriter, r *http.Request, n int) {
+				serveBody(w, r, `"v1"`)
+			},
+			requests: 1,
+			want:     testBody,
+		},
+		{
+			name:    "range not satisfiable",
+			state:   downloadState{PartialValidator: `"v1"`},
+			partial: testBody,
+			handler: func(w http.ResponseWriter, r *http.Request, n int) {
+				serveBody(w, r, `"v1"`)
+			},
+			requests: 2,
+			want:     testBody,
+		},
+		{
+			name:    "unexpected content range",
+			state:   downloadState{PartialValidator: `"v1"`},
+			partial: testBody[:10],
+			handler: func(w http.ResponseWriter, r *http.Request, n int) {
+				if n == 1 {
+					w.Header().Set("Content-Range", "bytes 0-9/10")
+					w.WriteHeader(http.StatusPartialContent)
+					return
+				}
+				serveBody(w, r, `"v1"`)
+			},
+			requests: 2,
+			want:     testBody,
+		},
+		{
+			name: "client error is not retried",
+			handler: func(w http.ResponseWriter, r *http.Request, n int) {
+				w.WriteHeader(http.StatusNotFound)
+			},
+			requests: 1,
+			fails:    true,
+		},
+		{
+			name: "too many requests is retried",
+			handler: func(w http.ResponseWriter, r *http.Request, n int) {
+				if n == 1 {
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				serveBody(w, r, `"v1"`)
+			},
+			requests: 2,
+			want:     testBody,
+		},
+		{
+			name: "server errors are retried",
+			handler: func(w http.ResponseWriter, r *http.Request, n int) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			requests: 2,
+			fails:    true,
+		},
+		{
+			name:  "rejected file is not downloaded again",
+			state: downloadState{RejectedETag: `"v1"`},
+			handler: func(w http.ResponseWriter, r *http.Request, n int) {
+				if r.Header.Get("If-None-Match") == `"v1"` {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				serveBody(w, r, `"v1"`)
+			},
+			requests: 1,
+			err:      ErrRejectedUnchanged,
+		},
+		{
+			name:  "registry changed after a rejection",
+			state: downloadState{RejectedETag: `"v0"`},
+			handler: func(w http.ResponseWriter, r *http.Request, n int) {
+				serveBody(w, r, `"v1"`)
+			},
+			requests: 1,
+			want:     testBody,
+		},
+		{
+			name:     "unchanged update",
+			state:    downloadState{ETag: `"v1"`, File: "yesterday.xml"},
+			previous: true,
+			update:   true,
+			handler: func(w http.ResponseWriter, r *http.Request, n int) {
+				w.WriteHeader(http.StatusNotModified)
+			},
+			requests: 1,
+			err:      ErrNotModified,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				test.handler(w, r, requests)
+			}))
+			defer server.Close()
+
+			dir := t.TempDir()
+			filePath := filepath.Join(dir, "today.xml")
+			previousFile := filepath.Join(dir, "yesterday.xml")
+			if err := saveDownloadState(dir, test.state); err != nil {
+				t.Fatal(err)
+			}
+			if test.previous {
+				writeFile(t, previousFile, testBody)
+				writeFile(t, database.CacheFile(previousFile), "cache")
+			}
+			if test.partial != "" {
+				writeFile(t, filePath+".tmp", test.partial)
+			}
+
+			downloader := NewDownloader(server.Client(), 1)
+			downloader.RetryDelay = 0
+			var err error
+			if test.update {
+				err = downloader.DownloadUpdate(server.URL, filePath)
+			} else {
+				err = downloader.Download(server.URL, filePath)
+			}
+
+			switch {
+			case test.err != nil && !errors.Is(err, test.err):
+				t.Errorf("error = %v, want %v", err, test.err)
+			case test.err == nil && test.fails != (err != nil):
+				t.Errorf("error = %v, want failure %v", err, test.fails)
+			}
+			if requests != test.requests {
+				t.Errorf("%d requests, want %d", requests, test.requests)
+			}
+
+			data, err := os.ReadFile(filePath)
+			if test.want == "" && err == nil {
+				t.Errorf("file was created with %q", data)
+			}
+			if test.want != "" && string(data) != test.want {
+				t.Errorf("file content = %q (%v), want %q", data, err, test.want)
+			}
+
+			// The previous snapshot stays in the history
+			if test.previous {
+				if data, err := os.ReadFile(previousFile); string(data) != testBody {
+					t.Errorf("previous file content = %q (%v), want %q", data, err, testBody)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadState(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", "Sat, 17 Oct 2026 06:00:00 GMT")
+		serveBody(w, r, `"v1"`)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "today.xml")
+	downloader := NewDownloader(server.Client(), 0)
+	if err := downloader.Download(server.URL, filePath); err != nil {
+		t.Fatal(err)
+	}
+
+	want := downloadState{ETag: `"v1"`, LastModified: "Sat, 17 Oct 2026 06:00:00 GMT", File: "today.xml"}
+	if state := loadDownloadState(dir); state != want {
+		t.Errorf("state after download = %+v, want %+v", state, want)
+	}
+
+	// A rejected download keeps only the validators needed to skip it
+	if err := rejectDownload(filePath); err != nil {
+		t.Fatal(err)
+	}
+	want = downloadState{RejectedETag: `"v1"`, RejectedLastModified: "Sat, 17 Oct 2026 06:00:00 GMT"}
+	if state := loadDownloadState(dir); state != want {
+		t.Errorf("state after rejection = %+v, want %+v", state, want)
+	}
+}
+
+func TestDownloadReusesCache(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	previousFile := filepath.Join(dir, "yesterday.xml")
+	writeFile(t, previousFile, testBody)
+	writeFile(t, database.CacheFile(previousFile), "cache")
+	if err := saveDownloadState(dir, downloadState{ETag: `"v1"`, File: "yesterday.xml"}); err != nil {
+		t.Fatal(err)
+	}
+
+	filePath := filepath.Join(dir, "today.xml")
+	if err := NewDownloader(server.Client(), 0).Download(server.URL, filePath); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{previousFile, database.CacheFile(previousFile), database.CacheFile(filePath)} {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("%s is missing: %v", filepath.Base(file), err)
+		}
+	}
+	if state := loadDownloadState(dir); state.File != "today.xml" || state.ETag != `"v1"` {
+		t.Errorf("state = %+v, want the validators for today.xml", state)
+	}
+}
+
+// writeFile writes a test file
+func writeFile(t *testing.T, filePath, content string) {
+	t.Helper()
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
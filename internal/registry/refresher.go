@@ -0,0 +1,552 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gorpl/internal/database"
+	"gorpl/internal/diff"
+	"gorpl/internal/validation"
+)
+
+// ErrRefreshInProgress is returned when data is already being refreshed or loaded
+var ErrRefreshInProgress = errors.New("refresh already in progress")
+
+// maxChangeSets is the number of applied incremental exports kept for inspection
+const maxChangeSets = 30
+
+// ErrSnapshotRejected is returned when a snapshot does not pass the activation checks
+var ErrSnapshotRejected = errors.New("snapshot rejected")
+
+// Status describes the state of data ingestion
+type Status struct {
+	SourceFile   string     `json:"sourceFile"`
+	Checksum     string     `json:"checksum"`
+	StanNaDzien  string     `json:"stanNaDzien"`
+	Products     int        `json:"products"`
+	Stale        bool       `json:"stale"`
+	Pinned       bool       `json:"pinned"`
+	LoadedAt     time.Time  `json:"loadedAt"`
+	LoadDuration string     `json:"loadDuration"`
+	Running      bool       `json:"running"`
+	LastAttempt  *time.Time `json:"lastAttempt,omitempty"`
+	LastError    string     `json:"lastError,omitempty"`
+	NextRun      *time.Time `json:"nextRun,omitempty"`
+}
+
+// Refresher periodically checks the registry for a new snapshot and swaps it into the product database
+type Refresher struct {
+	db         *database.ProductDatabase
+	config     Config
+	downloader *Downloader
+	activation ActivationPolicy
+	validate   bool
+	interval   time.Duration
+	retryDelay time.Duration
+	stop       chan struct{}
+	diffs      diffCache
+	// Called with the differences after the data is replaced
+	onChange func(*diff.Report)
+
+	// Serializes operations that replace the data
+	refreshing sync.Mutex
+
+	// Protects the fields below, never held during downloads or loading
+	mutex       sync.Mutex
+	currentFile string
+	// Day for which automatic refreshing is suspended after a rollback
+	pinnedFor string
+	// Report of the last validated snapshot
+	lastValidation *validation.Report
+	loadedAt       time.Time
+	loadDuration   time.Duration
+	running        bool
+	lastAttempt    time.Time
+	lastError      string
+	nextRun        time.Time
+	// Changes applied from incremental exports, newest first
+	changes []*database.ChangeSet
+}
+
+// NewRefresher creates a new Refresher for the database currently loaded from currentFile
+func NewRefresher(db *database.ProductDatabase, config Config, downloader *Downloader, activation ActivationPolicy, validate bool, currentFile string, interval time.Duration) *Refresher {
+	return &Refresher{
+		db:          db,
+		config:      config,
+		downloader:  downloader,
+		activation:  activation,
+		validate:    validate,
+		interval:    interval,
+		retryDelay:  5 * time.Minute,
+		stop:        make(chan struct{}),
+		currentFile: currentFile,
+		loadedAt:    time.Now(),
+	}
+}
+
+// Start runs the refresh loop in the background until Stop is called
+// While the served data is stale, the registry is checked more often
+func (r *Refresher) Start() {
+	go func() {
+		timer := time.NewTimer(r.scheduleNext())
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-timer.C:
+				if err := r.Refresh(); err != nil {
+					log.Printf("Error refreshing data: %v", err)
+				}
+				timer.Reset(r.scheduleNext())
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+
+	log.Printf("Scheduled data refresh every %v", r.interval)
+}
+
+// scheduleNext returns how long to wait before the next refresh and records when it will happen
+func (r *Refresher) scheduleNext() time.Duration {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delay := r.interval
+	if !r.upToDate(r.currentFile) && r.pinnedFor != r.config.DataFilePath() && r.retryDelay < r.interval {
+		delay = r.retryDelay
+	}
+	r.nextRun = time.Now().Add(delay)
+	return delay
+}
+
+// upToDate reports whether a file is today's snapshot or incremental export
+func (r *Refresher) upToDate(filePath string) bool {
+	if filePath != r.config.DataFilePath() && filePath != r.config.DeltaFilePath() {
+		return false
+	}
+	return !r.config.needsDownload(filePath)
+}
+
+// canApplyDelta reports whether today's incremental export can be applied on top of the data loaded from a file
+// Incremental exports only contain one day of changes, so the data has to be from yesterday
+func (r *Refresher) canApplyDelta(filePath string) bool {
+	if r.config.DeltaURL == "" {
+		return false
+	}
+	date, err := r.config.snapshotDate(filePath)
+	if err != nil {
+		return false
+	}
+	return date.Format("20060102") == time.Now().AddDate(0, 0, -1).Format("20060102")
+}
+
+// Stop stops the refresh loop
+func (r *Refresher) Stop() {
+	close(r.stop)
+}
+
+// Refresh downloads today's snapshot if it is not loaded yet and swaps it into the database
+// The new snapshot is parsed into a separate database, so requests are served from the old data until the swap
+func (r *Refresher) Refresh() error {
+	r.refreshing.Lock()
+	defer r.refreshing.Unlock()
+
+	return r.refresh(false)
+}
+
+// TriggerRefresh starts downloading and loading the registry in the background
+// Unlike the scheduled refresh, the registry is asked for changes even when today's file exists
+// and a previous rollback is cancelled
+func (r *Refresher) TriggerRefresh() error {
+	if !r.refreshing.TryLock() {
+		return ErrRefreshInProgress
+	}
+
+	r.mutex.Lock()
+	r.running = true
+	r.mutex.Unlock()
+
+	go func() {
+		defer r.refreshing.Unlock()
+
+		if err := r.refresh(true); err != nil {
+			log.Printf("Error refreshing data: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// refresh performs a refresh, the caller has to hold the refreshing lock
+func (r *Refresher) refresh(force bool) (err error) {
+	today := r.config.DataFilePath()
+
+	r.mutex.Lock()
+	currentFile, pinnedFor := r.currentFile, r.pinnedFor
+	r.mutex.Unlock()
+
+	if !force {
+		if r.upToDate(currentFile) {
+			return nil
+		}
+		if pinnedFor == today {
+			log.Printf("Skipping refresh, %s was rolled back to manually", currentFile)
+			return nil
+		}
+	}
+
+	r.mutex.Lock()
+	r.running = true
+	r.lastAttempt = time.Now()
+	r.mutex.Unlock()
+
+	defer func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		r.running = false
+		r.lastError = ""
+		if err != nil {
+			r.lastError = err.Error()
+		}
+	}()
+
+	if !force && r.canApplyDelta(currentFile) {
+		err = r.refreshDelta()
+		if err == nil {
+			return nil
+		}
+		log.Printf("Error applying incremental export, downloading the full registry: %v", err)
+	}
+
+	var filePath string
+	if force {
+		filePath, err = r.config.Download(r.downloader)
+	} else {
+		filePath, err = r.config.EnsureDataFile(r.downloader, "")
+	}
+	if err != nil {
+		// Keep serving the old data, but let clients know it is out of date
+		r.db.SetStale(true)
+		return err
+	}
+
+	if r.validate {
+		r.SetValidation(ValidateSnapshot(filePath))
+	}
+
+	return r.activate(filePath, true, false)
+}
+
+// refreshDelta downloads today's incremental export and applies it on top of the current data
+func (r *Refresher) refreshDelta() error {
+	filePath, err := r.config.DownloadDelta(r.downloader)
+	if err != nil {
+		return err
+	}
+
+	return r.activateDelta(filePath, true)
+}
+
+// activateDelta applies an incremental export on top of the current data in a separate database and swaps it in
+// With check set, the activation policy is applied and rejected files are quarantined
+func (r *Refresher) activateDelta(filePath string, check bool) error {
+	next := r.db.NewEmpty()
+	startTime := time.Now()
+
+	log.Printf("Applying incremental export %s...", filePath)
+	changes, err := next.LoadDeltaFromFile(r.db, filePath)
+	if err != nil {
+		return fmt.Errorf("error applying incremental export: %w", err)
+	}
+
+	if err := r.swapIn(next, filePath, startTime, check, false); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.changes = append([]*database.ChangeSet{changes}, r.changes...)
+	if len(r.changes) > maxChangeSets {
+		r.changes = r.changes[:maxChangeSets]
+	}
+
+	return nil
+}
+
+// activate loads a file into a separate database and swaps it in
+func (r *Refresher) activate(filePath string, check, pin bool) error {
+	next := r.db.NewEmpty()
+	startTime := time.Now()
+
+	log.Printf("Loading products from %s...", filePath)
+	if err := next.LoadFromFile(filePath); err != nil {
+		return fmt.Errorf("error loading products: %w", err)
+	}
+
+	return r.swapIn(next, filePath, startTime, check, pin)
+}
+
+// swapIn replaces the data with a loaded database
+// With check set, the activation policy is applied and rejected files are quarantined
+// With pin set, automatic refreshing is suspended until the next day
+func (r *Refresher) swapIn(next *database.ProductDatabase, filePath string, startTime time.Time, check, pin bool) error {
+	// Make sure a broken export never replaces good data
+	if check {
+		if err := r.checkActivation(next, filePath, filepath.Base(filePath)); err != nil {
+			// Keep serving the old data, but let clients know it is out of date
+			r.db.SetStale(true)
+			return err
+		}
+	}
+
+	previous, previousFile := r.db.Produkty(), r.db.Summary().SourceFile
+	r.db.ReplaceWith(next)
+	duration := time.Since(startTime)
+
+	if r.onChange != nil && previous != nil {
+		go func() {
+			report := diff.Compare(previous, next.Produkty())
+			report.FromFile = filepath.Base(previousFile)
+			report.ToFile = filepath.Base(filePath)
+			r.onChange(report)
+		}()
+	}
+
+	r.mutex.Lock()
+	r.currentFile = filePath
+	r.loadedAt = time.Now()
+	r.loadDuration = duration
+	r.pinnedFor = ""
+	if pin {
+		r.pinnedFor = r.config.DataFilePath()
+	}
+	r.mutex.Unlock()
+
+	log.Printf("Swapped in %d products from %s in %v", next.Summary().Products, filePath, duration)
+
+	if err := r.config.SaveActiveSummary(r.db.Summary()); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	// Clean up old files only after new data is active
+	r.ApplyRetention()
+
+	return nil
+}
+
+// ApplyRetention removes and compresses old snapshots according to the retention policy,
+// keeping the snapshot the data was loaded from
+func (r *Refresher) ApplyRetention() {
+	r.mutex.Lock()
+	active := r.currentFile
+	r.mutex.Unlock()
+
+	if err := r.config.applyRetention(active); err != nil {
+		log.Printf("Warning: error during cleanup: %v", err)
+	}
+}
+
+// checkActivation applies the activation policy to a loaded database
+// A rejected file is quarantined under the given name, uploads are loaded from a temporary file.
+// The served data is left as it is, only rejected refreshes mark it as stale.
+func (r *Refresher) checkActivation(next *database.ProductDatabase, filePath, name string) error {
+	reasons := r.activation.Check(r.db.Summary(), next.Summary())
+	if len(reasons) == 0 {
+		return nil
+	}
+
+	var err error
+	if name == filepath.Base(filePath) {
+		err = Quarantine(filePath, next.Summary(), reasons)
+	} else {
+		err = quarantineAs(filePath, name, next.Summary(), reasons)
+	}
+	if err != nil {
+		log.Printf("Error quarantining %s: %v", filePath, err)
+	}
+	return fmt.Errorf("%w: %s: %s", ErrSnapshotRejected, name, strings.Join(reasons, "; "))
+}
+
+// Status returns the state of data ingestion
+func (r *Refresher) Status() Status {
+	summary := r.db.Summary()
+	stale := r.db.IsStale()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	status := Status{
+		SourceFile:   summary.SourceFile,
+		Checksum:     summary.Checksum,
+		StanNaDzien:  summary.StanNaDzien,
+		Products:     summary.Products,
+		Stale:        stale,
+		Pinned:       r.pinnedFor == r.config.DataFilePath(),
+		LoadedAt:     r.loadedAt,
+		LoadDuration: r.loadDuration.String(),
+		Running:      r.running,
+		LastError:    r.lastError,
+	}
+	if !r.lastAttempt.IsZero() {
+		lastAttempt := r.lastAttempt
+		status.LastAttempt = &lastAttempt
+	}
+	if !r.nextRun.IsZero() {
+		nextRun := r.nextRun
+		status.NextRun = &nextRun
+	}
+
+	return status
+}
+
+// SetChangeListener sets a function called with the differences whenever the data is replaced
+func (r *Refresher) SetChangeListener(listener func(*diff.Report)) {
+	r.onChange = listener
+}
+
+// SetLoadDuration records how long loading the data before the refresher was created took
+func (r *Refresher) SetLoadDuration(duration time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.loadDuration = duration
+}
+
+// ListSnapshots returns snapshots stored in the data directory, newest first
+func (r *Refresher) ListSnapshots() ([]SnapshotInfo, error) {
+	r.mutex.Lock()
+	current := filepath.Base(r.currentFile)
+	r.mutex.Unlock()
+
+	snapshots, err := r.config.Snapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]SnapshotInfo, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		info := SnapshotInfo{
+			Name:       filepath.Base(snapshot),
+			Compressed: strings.HasSuffix(snapshot, ".gz"),
+			Active:     filepath.Base(snapshot) == current,
+		}
+		if date, err := r.config.snapshotDate(snapshot); err == nil {
+			info.Date = date.Format("2006-01-02")
+		}
+		if stat, err := os.Stat(snapshot); err == nil {
+			info.Size = stat.Size()
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// SetValidation sets the report of the last validated snapshot
+func (r *Refresher) SetValidation(report *validation.Report) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.lastValidation = report
+}
+
+// Validation returns the report of the last validated snapshot, nil when nothing was validated
+func (r *Refresher) Validation() *validation.Report {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.lastValidation
+}
+
+// ValidateSnapshot validates a snapshot from the data directory
+func (r *Refresher) ValidateSnapshot(name string) (*validation.Report, error) {
+	filePath, err := r.config.SnapshotPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return validation.ValidateFile(filePath)
+}
+
+// ListRejections returns snapshots rejected by the activation checks
+func (r *Refresher) ListRejections() ([]Rejection, error) {
+	return Rejections(r.config.DataDir)
+}
+
+// Rollback loads an older snapshot from the data directory and swaps it into the database
+// Automatic refreshing is suspended until the next day's registry export
+func (r *Refresher) Rollback(name string) error {
+	filePath, err := r.config.SnapshotPath(name)
+	if err != nil {
+		return err
+	}
+
+	if !r.refreshing.TryLock() {
+		return ErrRefreshInProgress
+	}
+	defer r.refreshing.Unlock()
+
+	log.Printf("Rolling back to %s...", filePath)
+	return r.activate(filePath, false, true)
+}
+
+// LoadFile loads an XML file from the data directory and swaps it into the database
+// The name is relative to the data directory, automatic refreshing is suspended until the next day
+func (r *Refresher) LoadFile(name string) error {
+	filePath, err := r.dataFile(name)
+	if err != nil {
+		return err
+	}
+
+	if !r.refreshing.TryLock() {
+		return ErrRefreshInProgress
+	}
+	defer r.refreshing.Unlock()
+
+	return r.activate(filePath, false, true)
+}
+
+// ApplyDelta applies an incremental export from the data directory on top of the current data
+// The name is relative to the data directory
+func (r *Refresher) ApplyDelta(name string) error {
+	filePath, err := r.dataFile(name)
+	if err != nil {
+		return err
+	}
+
+	if !r.refreshing.TryLock() {
+		return ErrRefreshInProgress
+	}
+	defer r.refreshing.Unlock()
+
+	return r.activateDelta(filePath, false)
+}
+
+// Changes returns the changes applied from incremental exports, newest first
+func (r *Refresher) Changes() []*database.ChangeSet {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]*database.ChangeSet{}, r.changes...)
+}
+
+// dataFile returns the path of an XML file in the data directory
+func (r *Refresher) dataFile(name string) (string, error) {
+	if !filepath.IsLocal(name) || !(strings.HasSuffix(name, ".xml") || strings.HasSuffix(name, ".xml.gz")) {
+		return "", fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+	}
+	filePath := filepath.Join(r.config.DataDir, name)
+	if info, err := os.Stat(filePath); err != nil || info.IsDir() {
+		return "", fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+	}
+	return filePath, nil
+}
@@ -0,0 +1,232 @@
+// Package registry contains code for fetching and maintaining local copies of the medicinal products registry
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gorpl/internal/validation"
+)
+
+const (
+	// DefaultURL is the URL for downloading XML file from the medicinal products registry
+	DefaultURL = "https://rejestry.ezdrowie.gov.pl/api/rpl/medicinal-products/public-pl-report/6.0.0/overall.xml"
+	// DefaultVersion is the version of the registry export format
+	DefaultVersion = "6.0.0"
+	// DefaultFileName is the template of data file names, {date} is replaced with YYYYMMDD and {version} with the version
+	DefaultFileName = "{date}_{version}.xml"
+	// deltaDir is the directory inside the data directory where incremental exports are stored
+	deltaDir = "deltas"
+)
+
+// ErrSnapshotNotFound is returned when a requested snapshot does not exist in the data directory
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// Config describes where the registry is downloaded from and how the local copies are stored
+// DeltaURL is the URL of the incremental export, incremental updates are disabled when it is empty
+type Config struct {
+	URL       string
+	DeltaURL  string
+	DataDir   string
+	Version   string
+	FileName  string
+	Retention RetentionPolicy
+}
+
+// DefaultConfig returns the configuration for the public registry stored in the data directory
+func DefaultConfig() Config {
+	return Config{
+		URL:      DefaultURL,
+		DataDir:  "data",
+		Version:  DefaultVersion,
+		FileName: DefaultFileName,
+	}
+}
+
+// Check checks that the configuration is usable
+func (c Config) Check() error {
+	if c.URL == "" {
+		return fmt.Errorf("registry URL is not set")
+	}
+	if strings.Count(c.FileName, "{date}") != 1 {
+		return fmt.Errorf("file name %q has to contain {date} exactly once", c.FileName)
+	}
+	if strings.ContainsRune(c.FileName, filepath.Separator) {
+		return fmt.Errorf("file name %q must not contain directories", c.FileName)
+	}
+	return nil
+}
+
+// fileName returns the data file name for a date
+func (c Config) fileName(date time.Time) string {
+	name := strings.ReplaceAll(c.FileName, "{version}", c.Version)
+	return strings.ReplaceAll(name, "{date}", date.Format("20060102"))
+}
+
+// DataFilePath returns the path to the data file based on the current date
+func (c Config) DataFilePath() string {
+	return filepath.Join(c.DataDir, c.fileName(time.Now()))
+}
+
+// DeltaFilePath returns the path to today's incremental export
+func (c Config) DeltaFilePath() string {
+	return filepath.Join(c.DataDir, deltaDir, c.fileName(time.Now()))
+}
+
+// snapshotPattern returns a pattern matching names of dated data files, e.g. 20250101_6.0.0.xml or 20250101_6.0.0.xml.gz
+func (c Config) snapshotPattern() *regexp.Regexp {
+	parts := strings.Split(strings.ReplaceAll(c.FileName, "{version}", c.Version), "{date}")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	return regexp.MustCompile(`^` + strings.Join(parts, `(\d{8})`) + `(\.gz)?$`)
+}
+
+// snapshotDate returns the date encoded in the snapshot file name
+func (c Config) snapshotDate(path string) (time.Time, error) {
+	match := c.snapshotPattern().FindStringSubmatch(filepath.Base(path))
+	if match == nil {
+		return time.Time{}, fmt.Errorf("not a snapshot file: %s", filepath.Base(path))
+	}
+	return time.ParseInLocation("20060102", match[1], time.Local)
+}
+
+// Snapshots returns paths of previously downloaded data files in the data directory, newest first
+// Files with an invalid date in the name and empty files are skipped
+func (c Config) Snapshots() ([]string, error) {
+	files, err := os.ReadDir(c.DataDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading data directory: %w", err)
+	}
+
+	dates := make(map[string]time.Time)
+	var snapshots []string
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		date, err := c.snapshotDate(file.Name())
+		if err != nil {
+			continue
+		}
+		if info, err := file.Info(); err != nil || info.Size() == 0 {
+			continue
+		}
+		path := filepath.Join(c.DataDir, file.Name())
+		dates[path] = date
+		snapshots = append(snapshots, path)
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return dates[snapshots[i]].After(dates[snapshots[j]])
+	})
+
+	return snapshots, nil
+}
+
+// SnapshotPath returns the path of a snapshot in the data directory
+// Only plain snapshot names are accepted, so that no other files can be reached
+func (c Config) SnapshotPath(name string) (string, error) {
+	if !c.snapshotPattern().MatchString(name) {
+		return "", fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+	}
+	filePath := filepath.Join(c.DataDir, name)
+	if _, err := os.Stat(filePath); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+	}
+	return filePath, nil
+}
+
+// needsDownload checks if the XML file should be downloaded
+// File is downloaded when it doesn't exist or is from a previous day
+func (c Config) needsDownload(filePath string) bool {
+	_, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		return true
+	}
+	if err != nil {
+		log.Printf("Error checking file: %v", err)
+		return true
+	}
+
+	expected := c.DataFilePath()
+	return filepath.Base(filePath) != filepath.Base(expected)
+}
+
+// EnsureDataFile ensures that the XML file is available and up to date
+func (c Config) EnsureDataFile(downloader *Downloader, providedFile string) (string, error) {
+	if providedFile != "" && providedFile != c.DataFilePath() {
+		if _, err := os.Stat(providedFile); err == nil {
+			log.Printf("Using user-provided file: %s", providedFile)
+			return providedFile, nil
+		}
+		log.Printf("Provided file does not exist: %s", providedFile)
+	}
+
+	filePath := c.DataFilePath()
+
+	if !c.needsDownload(filePath) {
+		log.Printf("Using existing file: %s", filePath)
+		return filePath, nil
+	}
+
+	log.Printf("File %s needs to be downloaded", filePath)
+	return c.Download(downloader)
+}
+
+// Download downloads today's data file, even if it already exists
+// Thanks to conditional requests, an unchanged registry is not transferred again
+// Old snapshots are cleaned up by the Refresher once the file is activated
+func (c Config) Download(downloader *Downloader) (string, error) {
+	filePath := c.DataFilePath()
+
+	if err := downloader.Download(c.URL, filePath); err != nil {
+		return "", fmt.Errorf("cannot download file: %w", err)
+	}
+
+	return filePath, nil
+}
+
+// DownloadDelta downloads today's incremental export
+// An unchanged export is an already applied one, so ErrNotModified is returned for it
+func (c Config) DownloadDelta(downloader *Downloader) (string, error) {
+	filePath := c.DeltaFilePath()
+
+	if err := downloader.DownloadUpdate(c.DeltaURL, filePath); err != nil {
+		return "", fmt.Errorf("cannot download incremental export: %w", err)
+	}
+
+	// Incremental exports are kept like snapshots, but never compressed
+	deltas := c
+	deltas.DataDir = filepath.Dir(filePath)
+	deltas.Retention.Compress = false
+	if err := deltas.applyRetention(filePath); err != nil {
+		log.Printf("Warning: error during cleanup: %v", err)
+	}
+
+	return filePath, nil
+}
+
+// ValidateSnapshot validates a downloaded snapshot and logs a summary of the report
+// Validation problems are reported, but do not prevent the snapshot from being used
+func ValidateSnapshot(filePath string) *validation.Report {
+	report, err := validation.ValidateFile(filePath)
+	if err != nil {
+		log.Printf("Error validating %s: %v", filePath, err)
+		return nil
+	}
+
+	if report.Valid {
+		log.Printf("Validated %s against the schema in %s", filePath, report.Duration)
+	} else {
+		log.Printf("Warning: %s does not match the schema, %d issues found: %v", filePath, report.TotalIssues, report.IssueCounts)
+	}
+	return report
+}
@@ -0,0 +1,109 @@
+package registry
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"gorpl/internal/database"
+)
+
+// RetentionPolicy describes which previously downloaded snapshots are kept in the data directory
+// The newest and the active snapshot are always kept, zero values disable the respective limit
+type RetentionPolicy struct {
+	KeepSnapshots int
+	KeepDays      int
+	Compress      bool
+}
+
+// SnapshotInfo describes a snapshot stored in the data directory
+type SnapshotInfo struct {
+	Name       string `json:"name"`
+	Date       string `json:"date"`
+	Size       int64  `json:"size"`
+	Compressed bool   `json:"compressed"`
+	Active     bool   `json:"active"`
+}
+
+// applyRetention removes and compresses old snapshots in the data directory according to the retention policy
+// The active snapshot is never touched, so that there is good data to fall back to
+func (c Config) applyRetention(active string) error {
+	snapshots, err := c.Snapshots()
+	if err != nil {
+		return err
+	}
+
+	policy := c.Retention
+	cutoff := time.Now().AddDate(0, 0, -policy.KeepDays)
+	for i, snapshot := range snapshots {
+		// Never touch the newest and the active snapshot
+		if i == 0 || snapshot == active {
+			continue
+		}
+
+		date, err := c.snapshotDate(snapshot)
+		if err != nil {
+			continue
+		}
+
+		if (policy.KeepSnapshots > 0 && i >= policy.KeepSnapshots) || (policy.KeepDays > 0 && date.Before(cutoff)) {
+			if err := os.Remove(snapshot); err != nil {
+				log.Printf("Error deleting file %s: %v", snapshot, err)
+			} else {
+				log.Printf("Deleted file: %s", snapshot)
+			}
+			os.Remove(database.CacheFile(snapshot))
+			continue
+		}
+
+		if policy.Compress && !strings.HasSuffix(snapshot, ".gz") {
+			if err := compressFile(snapshot); err != nil {
+				log.Printf("Error compressing file %s: %v", snapshot, err)
+			} else {
+				log.Printf("Compressed file: %s", snapshot)
+				// Compressed snapshots are only kept for rollbacks, they do not need a cache
+				os.Remove(database.CacheFile(snapshot))
+			}
+		}
+	}
+
+	return nil
+}
+
+// compressFile replaces a file with its gzip compressed copy
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open file: %w", err)
+	}
+	defer in.Close()
+
+	tempFile := path + ".gz.tmp"
+	out, err := os.Create(tempFile)
+	if err != nil {
+		return fmt.Errorf("cannot create temporary file: %w", err)
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("error compressing data: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("error compressing data: %w", err)
+	}
+	out.Close()
+
+	if err := os.Rename(tempFile, path+".gz"); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("cannot rename file: %w", err)
+	}
+
+	return os.Remove(path)
+}
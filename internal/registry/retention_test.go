@@ -0,0 +1,182 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"gorpl/internal/database"
+	"gorpl/internal/model"
+)
+
+// snapshotXML returns a registry export with the given number of products, each with one package
+func snapshotXML(stanNaDzien string, products int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<produktyLecznicze xmlns=%q stanNaDzien=%q>\n", model.Namespace, stanNaDzien)
+	for i := 1; i <= products; i++ {
+		fmt.Fprintf(&b, "  <produktLeczniczy id=\"%d\" nazwaProduktu=\"Produkt %d\"><opakowania><opakowanie id=\"%d1\" kodGTIN=\"0590999%07d\" skasowane=\"NIE\"/></opakowania></produktLeczniczy>\n", i, i, i, i)
+	}
+	b.WriteString("</produktyLecznicze>\n")
+	return b.String()
+}
+
+// writeSnapshot writes a registry export made by snapshotXML
+func writeSnapshot(t *testing.T, filePath, stanNaDzien string, products int) {
+	t.Helper()
+	writeFile(t, filePath, snapshotXML(stanNaDzien, products))
+}
+
+// testConfig returns a configuration using a temporary data directory
+func testConfig(t *testing.T) Config {
+	config := DefaultConfig()
+	config.DataDir = t.TempDir()
+	return config
+}
+
+// daysAgo returns the path of the snapshot from the given number of days ago
+func daysAgo(config Config, days int) string {
+	return filepath.Join(config.DataDir, config.fileName(time.Now().AddDate(0, 0, -days)))
+}
+
+func TestApplyRetention(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		active int
+		// Days ago of the remaining snapshots, compressed ones are negative
+		want []int
+	}{
+		{"no limits", RetentionPolicy{}, 0, []int{0, 1, 2, 3, 4}},
+		{"keep snapshots", RetentionPolicy{KeepSnapshots: 3}, 0, []int{0, 1, 2}},
+		{"keep snapshots and the active one", RetentionPolicy{KeepSnapshots: 3}, 4, []int{0, 1, 2, 4}},
+		{"keep the newest one", RetentionPolicy{KeepSnapshots: 1}, 2, []int{0, 2}},
+		{"keep days", RetentionPolicy{KeepDays: 2}, 0, []int{0, 1}},
+		{"keep days and the active one", RetentionPolicy{KeepDays: 2}, 3, []int{0, 1, 3}},
+		{"compress", RetentionPolicy{Compress: true}, 0, []int{0, -1, -2, -3, -4}},
+		{"compress all but the active one", RetentionPolicy{KeepSnapshots: 3, Compress: true}, 1, []int{0, 1, -2}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := testConfig(t)
+			config.Retention = test.policy
+			for days := 0; days < 5; days++ {
+				writeSnapshot(t, daysAgo(config, days), "2026-10-17", 1)
+				writeFile(t, database.CacheFile(daysAgo(config, days)), "cache")
+			}
+
+			if err := config.applyRetention(daysAgo(config, test.active)); err != nil {
+				t.Fatal(err)
+			}
+
+			var want []string
+			for _, days := range test.want {
+				if days < 0 {
+					want = append(want, filepath.Base(daysAgo(config, -days))+".gz")
+					continue
+				}
+				want = append(want, filepath.Base(daysAgo(config, days)), filepath.Base(database.CacheFile(daysAgo(config, days))))
+			}
+			sort.Strings(want)
+
+			files, err := filepath.Glob(filepath.Join(config.DataDir, "*"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, file := range files {
+				got = append(got, filepath.Base(file))
+			}
+
+			if strings.Join(got, " ") != strings.Join(want, " ") {
+				t.Errorf("files = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// newTestRefresher creates a refresher serving the snapshot at filePath
+// The registry is served by handler, with a nil handler it must not be contacted
+func newTestRefresher(t *testing.T, config Config, filePath string, handler http.HandlerFunc) *Refresher {
+	t.Helper()
+
+	if handler == nil {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("unexpected request to the registry: %s", r.URL)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	config.URL = server.URL
+
+	db := database.NewProductDatabase()
+	db.SetProgressFunc(nil)
+	if err := db.LoadFromFile(filePath); err != nil {
+		t.Fatal(err)
+	}
+
+	downloader := NewDownloader(server.Client(), 0)
+	activation := ActivationPolicy{MinProducts: 1, MaxProductDrop: 10, MaxGtinDrop: 10}
+	return NewRefresher(db, config, downloader, activation, false, filePath, time.Hour)
+}
+
+func TestRollback(t *testing.T) {
+	config := testConfig(t)
+	config.Retention = RetentionPolicy{KeepSnapshots: 1}
+	today, yesterday := daysAgo(config, 0), daysAgo(config, 1)
+	writeSnapshot(t, today, "2026-10-17", 10)
+	writeSnapshot(t, yesterday, "2026-10-16", 5)
+
+	refresher := newTestRefresher(t, config, today, nil)
+
+	// Rollbacks are not checked against the active data
+	if err := refresher.Rollback(filepath.Base(yesterday)); err != nil {
+		t.Fatal(err)
+	}
+	status := refresher.Status()
+	if status.SourceFile != yesterday || status.Products != 5 || !status.Pinned {
+		t.Errorf("status after rollback = %+v, want 5 products from %s pinned", status, yesterday)
+	}
+
+	// Refreshing is suspended for the rest of the day and the snapshots are kept
+	if err := refresher.Refresh(); err != nil {
+		t.Errorf("Refresh after rollback: %v", err)
+	}
+	if got := refresher.Status().SourceFile; got != yesterday {
+		t.Errorf("source after refresh = %s, want %s", got, yesterday)
+	}
+	for _, file := range []string{today, yesterday} {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("%s was removed: %v", filepath.Base(file), err)
+		}
+	}
+
+	// Back to today's snapshot
+	if err := refresher.Rollback(filepath.Base(today)); err != nil {
+		t.Fatal(err)
+	}
+	if got := refresher.Status().Products; got != 10 {
+		t.Errorf("products after rolling forward = %d, want 10", got)
+	}
+}
+
+func TestRollbackUnknownSnapshot(t *testing.T) {
+	config := testConfig(t)
+	today := daysAgo(config, 0)
+	writeSnapshot(t, today, "2026-10-17", 1)
+	refresher := newTestRefresher(t, config, today, nil)
+
+	for _, name := range []string{"20200101_6.0.0.xml", "../" + filepath.Base(today), ".download-state.json", ""} {
+		if err := refresher.Rollback(name); !errors.Is(err, ErrSnapshotNotFound) {
+			t.Errorf("Rollback(%q) error = %v, want %v", name, err, ErrSnapshotNotFound)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package registry
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gorpl/internal/database"
+	"gorpl/internal/validation"
+)
+
+// ErrInvalidUpload is returned when an uploaded file is not a registry export
+var ErrInvalidUpload = errors.New("invalid upload")
+
+// Upload stores an uploaded registry export as today's snapshot and swaps it into the database
+// The export may be gzip compressed, it is stored uncompressed just like a downloaded file
+// The file is validated against the schema and has to pass the activation checks before it replaces today's snapshot
+func (r *Refresher) Upload(src io.Reader) (*validation.Report, error) {
+	if !r.refreshing.TryLock() {
+		return nil, ErrRefreshInProgress
+	}
+	defer r.refreshing.Unlock()
+
+	if err := os.MkdirAll(r.config.DataDir, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create data directory: %w", err)
+	}
+
+	filePath := r.config.DataFilePath()
+	tempFile := filePath + ".upload.tmp"
+	if err := saveUpload(src, tempFile); err != nil {
+		os.Remove(tempFile)
+		return nil, err
+	}
+
+	// Reject files which are not registry exports before they replace today's snapshot
+	report, err := validation.ValidateFile(tempFile)
+	if err != nil {
+		os.Remove(tempFile)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUpload, err)
+	}
+	report.File = filePath
+	if !report.Valid {
+		log.Printf("Warning: uploaded file does not match the schema, %d issues found: %v", report.TotalIssues, report.IssueCounts)
+	}
+	r.SetValidation(report)
+
+	// Today's snapshot is only replaced once the upload passes the activation checks
+	next := r.db.NewEmpty()
+	startTime := time.Now()
+	log.Printf("Loading products from uploaded file %s...", tempFile)
+	if err := next.LoadFromFile(tempFile); err != nil {
+		os.Remove(tempFile)
+		os.Remove(database.CacheFile(tempFile))
+		return report, fmt.Errorf("error loading products: %w", err)
+	}
+	if err := r.checkActivation(next, tempFile, filepath.Base(filePath)); err != nil {
+		return report, err
+	}
+
+	if err := os.Rename(tempFile, filePath); err != nil {
+		os.Remove(tempFile)
+		os.Remove(database.CacheFile(tempFile))
+		return report, fmt.Errorf("cannot rename file: %w", err)
+	}
+	// The cache is still valid for the same content
+	os.Remove(database.CacheFile(filePath))
+	os.Rename(database.CacheFile(tempFile), database.CacheFile(filePath))
+	next.SetSourceFile(filePath)
+	log.Printf("Stored uploaded file as %s", filePath)
+	// The validators of a downloaded file of the same name no longer describe it
+	if err := forgetDownload(filePath); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	if err := r.swapIn(next, filePath, startTime, false, false); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// saveUpload writes an uploaded file to disk, decompressing it when it is gzip compressed
+func saveUpload(src io.Reader, filePath string) error {
+	input := bufio.NewReaderSize(src, 1<<20)
+
+	var reader io.Reader = input
+	if magic, err := input.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(input)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidUpload, err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	out, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("cannot create file: %w", err)
+	}
+	defer out.Close()
+
+	written, err := io.Copy(out, reader)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidUpload, err)
+	}
+	if written == 0 {
+		return fmt.Errorf("%w: file is empty", ErrInvalidUpload)
+	}
+
+	return out.Close()
+}
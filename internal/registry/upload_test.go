@@ -0,0 +1,113 @@
+package registry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// uploadTestRefresher creates a refresher serving today's downloaded snapshot with 10 products
+func uploadTestRefresher(t *testing.T) (*Refresher, string) {
+	t.Helper()
+
+	config := testConfig(t)
+	today := daysAgo(config, 0)
+	writeSnapshot(t, today, "2026-10-17", 10)
+	if err := saveDownloadState(config.DataDir, downloadState{ETag: `"v1"`, File: filepath.Base(today)}); err != nil {
+		t.Fatal(err)
+	}
+
+	return newTestRefresher(t, config, today, nil), today
+}
+
+func TestUpload(t *testing.T) {
+	refresher, today := uploadTestRefresher(t)
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(snapshotXML("2026-10-17", 11)))
+	gz.Close()
+
+	report, err := refresher.Upload(&compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid || report.File != today {
+		t.Errorf("report = %+v, want a valid report of %s", report, today)
+	}
+
+	status := refresher.Status()
+	if status.SourceFile != today || status.Products != 11 || status.Stale {
+		t.Errorf("status = %+v, want 11 products from %s", status, today)
+	}
+	// The upload is stored uncompressed in place of the downloaded snapshot
+	if data, err := os.ReadFile(today); err != nil || string(data) != snapshotXML("2026-10-17", 11) {
+		t.Errorf("stored file = %.60q (%v), want the uploaded export", data, err)
+	}
+	if _, err := os.Stat(today + ".upload.tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file was kept: %v", err)
+	}
+	// An unchanged registry is not mistaken for the upload
+	if state := loadDownloadState(filepath.Dir(today)); state.File != "" || state.ETag != "" {
+		t.Errorf("download state = %+v, want no validators", state)
+	}
+}
+
+func TestUploadRejected(t *testing.T) {
+	refresher, today := uploadTestRefresher(t)
+
+	_, err := refresher.Upload(strings.NewReader(snapshotXML("2026-10-17", 2)))
+	if !errors.Is(err, ErrSnapshotRejected) {
+		t.Fatalf("Upload error = %v, want %v", err, ErrSnapshotRejected)
+	}
+
+	// A bad upload leaves the served data and today's snapshot as they are
+	status := refresher.Status()
+	if status.SourceFile != today || status.Products != 10 || status.Stale {
+		t.Errorf("status = %+v, want 10 fresh products from %s", status, today)
+	}
+	if data, err := os.ReadFile(today); err != nil || string(data) != snapshotXML("2026-10-17", 10) {
+		t.Errorf("today's snapshot was replaced: %v", err)
+	}
+	if state := loadDownloadState(filepath.Dir(today)); state.File != filepath.Base(today) || state.ETag != `"v1"` {
+		t.Errorf("download state = %+v, want the validators of today's snapshot", state)
+	}
+
+	rejections, err := refresher.ListRejections()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rejections) != 1 || rejections[0].Name != filepath.Base(today) || rejections[0].Products != 2 {
+		t.Errorf("rejections = %+v, want the upload", rejections)
+	}
+}
+
+func TestUploadInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"empty", ""},
+		{"not XML", "id;name\n1;Apap\n"},
+		{"other document", `<html><body>Error</body></html>`},
+		{"broken gzip", "\x1f\x8b\x08broken"},
+	}
+
+	for _, test := range tests {
+		refresher, today := uploadTestRefresher(t)
+
+		if _, err := refresher.Upload(strings.NewReader(test.content)); !errors.Is(err, ErrInvalidUpload) {
+			t.Errorf("%s: Upload error = %v, want %v", test.name, err, ErrInvalidUpload)
+		}
+		if got := refresher.Status().Products; got != 10 {
+			t.Errorf("%s: %d products after the upload, want 10", test.name, got)
+		}
+		if _, err := os.Stat(today + ".upload.tmp"); !os.IsNotExist(err) {
+			t.Errorf("%s: temporary file was kept: %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Package validation contains code for checking registry exports against the bundled XSD schemas
+package validation
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gorpl/docs"
+)
+
+// xsdSchema is the subset of XML Schema used by the registry schemas
+type xsdSchema struct {
+	Elements    []xsdElement    `xml:"element"`
+	SimpleTypes []xsdSimpleType `xml:"simpleType"`
+}
+
+type xsdElement struct {
+	Name        string          `xml:"name,attr"`
+	Type        string          `xml:"type,attr"`
+	MaxOccurs   string          `xml:"maxOccurs,attr"`
+	ComplexType *xsdComplexType `xml:"complexType"`
+}
+
+type xsdComplexType struct {
+	Sequence      []xsdElement   `xml:"sequence>element"`
+	Attributes    []xsdAttribute `xml:"attribute"`
+	SimpleContent *struct {
+		Attributes []xsdAttribute `xml:"extension>attribute"`
+	} `xml:"simpleContent"`
+}
+
+type xsdAttribute struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type xsdSimpleType struct {
+	Name         string `xml:"name,attr"`
+	Enumerations []struct {
+		Value string `xml:"value,attr"`
+	} `xml:"restriction>enumeration"`
+	MaxLength *struct {
+		Value int `xml:"value,attr"`
+	} `xml:"restriction>maxLength"`
+}
+
+// simpleType holds the restrictions of a named simple type
+type simpleType struct {
+	name      string
+	enum      []string
+	maxLength int
+}
+
+// elementRule describes what is allowed inside an element
+type elementRule struct {
+	name       string
+	maxOccurs  int // 0 means unbounded
+	text       *simpleType
+	attributes map[string]*simpleType
+	children   map[string]*elementRule
+}
+
+var (
+	rootRule    *elementRule
+	schemaError error
+	schemaOnce  sync.Once
+)
+
+// loadSchema parses the bundled schemas into element rules
+func loadSchema() (*elementRule, error) {
+	schemaOnce.Do(func() {
+		types := make(map[string]*simpleType)
+
+		var common xsdSchema
+		if schemaError = parseSchema("commonTypes.xsd", &common); schemaError != nil {
+			return
+		}
+		for _, st := range common.SimpleTypes {
+			t := &simpleType{name: st.Name}
+			for _, e := range st.Enumerations {
+				t.enum = append(t.enum, e.Value)
+			}
+			if st.MaxLength != nil {
+				t.maxLength = st.MaxLength.Value
+			}
+			types[st.Name] = t
+		}
+
+		var scheme xsdSchema
+		if schemaError = parseSchema("scheme.xsd", &scheme); schemaError != nil {
+			return
+		}
+		if len(scheme.Elements) != 1 {
+			schemaError = fmt.Errorf("scheme.xsd: expected a single root element, have %d", len(scheme.Elements))
+			return
+		}
+		rootRule = buildRule(scheme.Elements[0], types)
+	})
+
+	return rootRule, schemaError
+}
+
+// parseSchema decodes one of the bundled schema files
+func parseSchema(name string, schema *xsdSchema) error {
+	data, err := docs.Schemas.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", name, err)
+	}
+	if err := xml.Unmarshal(data, schema); err != nil {
+		return fmt.Errorf("error parsing %s: %w", name, err)
+	}
+	return nil
+}
+
+// buildRule converts an element declaration into an element rule
+func buildRule(element xsdElement, types map[string]*simpleType) *elementRule {
+	rule := &elementRule{
+		name:       element.Name,
+		text:       lookupType(element.Type, types),
+		attributes: make(map[string]*simpleType),
+		children:   make(map[string]*elementRule),
+	}
+
+	// maxOccurs defaults to 1
+	rule.maxOccurs = 1
+	if element.MaxOccurs == "unbounded" {
+		rule.maxOccurs = 0
+	} else if n, err := strconv.Atoi(element.MaxOccurs); err == nil {
+		rule.maxOccurs = n
+	}
+
+	if element.ComplexType == nil {
+		return rule
+	}
+
+	attributes := element.ComplexType.Attributes
+	if element.ComplexType.SimpleContent != nil {
+		attributes = append(attributes, element.ComplexType.SimpleContent.Attributes...)
+	}
+	for _, attr := range attributes {
+		rule.attributes[attr.Name] = lookupType(attr.Type, types)
+	}
+	for _, child := range element.ComplexType.Sequence {
+		rule.children[child.Name] = buildRule(child, types)
+	}
+
+	return rule
+}
+
+// lookupType returns restrictions of a type referenced as "prefix:name"
+// Built-in types like xs:string have no restrictions and result in nil
+func lookupType(name string, types map[string]*simpleType) *simpleType {
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		name = name[i+1:]
+	}
+	return types[name]
+}
@@ -0,0 +1,237 @@
+package validation
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorpl/internal/model"
+)
+
+// maxReportedIssues limits the number of issues listed in a report, all issues are still counted
+const maxReportedIssues = 1000
+
+// Kinds of validation issues
+const (
+	IssueUnknownElement   = "unknownElement"
+	IssueUnknownAttribute = "unknownAttribute"
+	IssueMaxLength        = "maxLength"
+	IssueEnumeration      = "enumeration"
+	IssueMaxOccurs        = "maxOccurs"
+	IssueNamespace        = "namespace"
+)
+
+// Issue describes a single place where the document does not match the schema
+type Issue struct {
+	Kind      string `json:"kind"`
+	Path      string `json:"path"`
+	Line      int    `json:"line"`
+	ProductID string `json:"productId,omitempty"`
+	Value     string `json:"value,omitempty"`
+	Message   string `json:"message"`
+}
+
+// Report is the result of validating a registry export
+type Report struct {
+	File        string         `json:"file"`
+	Valid       bool           `json:"valid"`
+	ValidatedAt time.Time      `json:"validatedAt"`
+	Duration    string         `json:"duration"`
+	Products    int            `json:"products"`
+	TotalIssues int            `json:"totalIssues"`
+	IssueCounts map[string]int `json:"issueCounts"`
+	Issues      []Issue        `json:"issues"`
+}
+
+// frame holds the validation state of an open element
+type frame struct {
+	rule   *elementRule
+	path   string
+	counts map[string]int
+	text   strings.Builder
+}
+
+// ValidateFile validates an XML file, optionally gzip compressed (.xml.gz)
+func ValidateFile(filename string) (*Report, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+	defer file.Close()
+
+	var input io.Reader = bufio.NewReaderSize(file, 1<<20)
+	if strings.HasSuffix(filename, ".gz") {
+		gz, err := gzip.NewReader(input)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing file: %w", err)
+		}
+		defer gz.Close()
+		input = gz
+	}
+
+	report, err := Validate(input)
+	if err != nil {
+		return nil, err
+	}
+	report.File = filename
+	return report, nil
+}
+
+// Validate checks a registry export against the bundled schemas
+// It reports elements and attributes unknown to the schema, which the model silently drops,
+// values exceeding maxLength, values outside of enumerations and too many occurrences of an element
+func Validate(r io.Reader) (*Report, error) {
+	root, err := loadSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	startTime := time.Now()
+	report := &Report{
+		ValidatedAt: startTime,
+		IssueCounts: make(map[string]int),
+		Issues:      []Issue{},
+	}
+
+	decoder := xml.NewDecoder(r)
+	var stack []*frame
+	var productID string
+	var hasRoot bool
+
+	addIssue := func(issue Issue) {
+		issue.Line, _ = decoder.InputPos()
+		issue.ProductID = productID
+		report.TotalIssues++
+		report.IssueCounts[issue.Kind]++
+		if len(report.Issues) < maxReportedIssues {
+			report.Issues = append(report.Issues, issue)
+		}
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error decoding XML: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			var rule *elementRule
+			path := t.Name.Local
+
+			if len(stack) == 0 {
+				if t.Name.Local != root.name {
+					return nil, fmt.Errorf("error decoding XML: expected element <%s> but have <%s>", root.name, t.Name.Local)
+				}
+				if t.Name.Space != model.Namespace {
+					addIssue(Issue{Kind: IssueNamespace, Path: path, Value: t.Name.Space,
+						Message: fmt.Sprintf("unexpected namespace, expected %s", model.Namespace)})
+				}
+				rule = root
+				hasRoot = true
+			} else {
+				parent := stack[len(stack)-1]
+				path = parent.path + "/" + t.Name.Local
+				rule = parent.rule.children[t.Name.Local]
+
+				if rule == nil {
+					addIssue(Issue{Kind: IssueUnknownElement, Path: path, Message: "element is not defined in the schema"})
+					if err := decoder.Skip(); err != nil {
+						return nil, fmt.Errorf("error decoding XML: %w", err)
+					}
+					continue
+				}
+
+				parent.counts[t.Name.Local]++
+				if rule.maxOccurs > 0 && parent.counts[t.Name.Local] == rule.maxOccurs+1 {
+					addIssue(Issue{Kind: IssueMaxOccurs, Path: path,
+						Message: fmt.Sprintf("element occurs more than %d times", rule.maxOccurs)})
+				}
+			}
+
+			if t.Name.Local == "produktLeczniczy" {
+				report.Products++
+				productID = ""
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "id" {
+						productID = attr.Value
+					}
+				}
+			}
+
+			for _, attr := range t.Attr {
+				// Namespace declarations are not attributes of the document
+				if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+					continue
+				}
+				attrType, ok := rule.attributes[attr.Name.Local]
+				if !ok || attr.Name.Space != "" {
+					addIssue(Issue{Kind: IssueUnknownAttribute, Path: path + "/@" + attr.Name.Local, Value: attr.Value,
+						Message: "attribute is not defined in the schema"})
+					continue
+				}
+				checkValue(attrType, path+"/@"+attr.Name.Local, attr.Value, addIssue)
+			}
+
+			stack = append(stack, &frame{rule: rule, path: path, counts: make(map[string]int)})
+
+		case xml.CharData:
+			if len(stack) > 0 && stack[len(stack)-1].rule.text != nil {
+				stack[len(stack)-1].text.Write(t)
+			}
+
+		case xml.EndElement:
+			if len(stack) == 0 {
+				continue
+			}
+			current := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if current.rule.text != nil {
+				checkValue(current.rule.text, current.path, current.text.String(), addIssue)
+			}
+			if current.rule.name == "produktLeczniczy" {
+				productID = ""
+			}
+		}
+	}
+
+	if !hasRoot {
+		return nil, fmt.Errorf("error decoding XML: document is empty")
+	}
+
+	report.Valid = report.TotalIssues == 0
+	report.Duration = time.Since(startTime).String()
+
+	return report, nil
+}
+
+// checkValue checks a value against the restrictions of a simple type
+func checkValue(t *simpleType, path, value string, addIssue func(Issue)) {
+	if t == nil {
+		return
+	}
+
+	if t.maxLength > 0 && utf8.RuneCountInString(value) > t.maxLength {
+		addIssue(Issue{Kind: IssueMaxLength, Path: path, Value: value,
+			Message: fmt.Sprintf("%s value is longer than %d characters", t.name, t.maxLength)})
+	}
+
+	if len(t.enum) > 0 {
+		for _, allowed := range t.enum {
+			if value == allowed {
+				return
+			}
+		}
+		addIssue(Issue{Kind: IssueEnumeration, Path: path, Value: value,
+			Message: fmt.Sprintf("%s value must be one of %q", t.name, t.enum)})
+	}
+}
@@ -0,0 +1,139 @@
+package validation
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gorpl/internal/model"
+)
+
+// document wraps products in the root element of a registry export
+func document(products string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?><produktyLecznicze xmlns="` + model.Namespace + `" stanNaDzien="2026-10-17">` +
+		products + `</produktyLecznicze>`
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		// Issue kinds with their paths
+		want map[string]string
+	}{
+		{
+			name: "valid",
+			document: document(`<produktLeczniczy id="1" nazwaProduktu="Apap" status="Nowy"><kodyATC><kodATC>N02BE01</kodATC></kodyATC>` +
+				`<opakowania><opakowanie id="11" kodGTIN="05909990022427" skasowane="NIE"/></opakowania></produktLeczniczy>`),
+		},
+		{
+			name:     "unknown element",
+			document: document(`<produktLeczniczy id="1"><nowePole><x/></nowePole></produktLeczniczy>`),
+			want:     map[string]string{IssueUnknownElement: "produktyLecznicze/produktLeczniczy/nowePole"},
+		},
+		{
+			name:     "unknown attribute",
+			document: document(`<produktLeczniczy id="1" nowyAtrybut="x"/>`),
+			want:     map[string]string{IssueUnknownAttribute: "produktyLecznicze/produktLeczniczy/@nowyAtrybut"},
+		},
+		{
+			name:     "value too long",
+			document: document(`<produktLeczniczy id="1" nazwaProduktu="` + strings.Repeat("ą", 256) + `"/>`),
+			want:     map[string]string{IssueMaxLength: "produktyLecznicze/produktLeczniczy/@nazwaProduktu"},
+		},
+		{
+			name:     "text too long",
+			document: document(`<produktLeczniczy id="1"><kodyATC><kodATC>` + strings.Repeat("N", 256) + `</kodATC></kodyATC></produktLeczniczy>`),
+			want:     map[string]string{IssueMaxLength: "produktyLecznicze/produktLeczniczy/kodyATC/kodATC"},
+		},
+		{
+			name:     "value outside of enumeration",
+			document: document(`<produktLeczniczy id="1"><opakowania><opakowanie skasowane="tak"/></opakowania></produktLeczniczy>`),
+			want:     map[string]string{IssueEnumeration: "produktyLecznicze/produktLeczniczy/opakowania/opakowanie/@skasowane"},
+		},
+		{
+			name:     "element occurs too often",
+			document: document(`<produktLeczniczy id="1"><kodyATC/><kodyATC/></produktLeczniczy>`),
+			want:     map[string]string{IssueMaxOccurs: "produktyLecznicze/produktLeczniczy/kodyATC"},
+		},
+		{
+			name:     "other namespace",
+			document: `<produktyLecznicze xmlns="urn:other"/>`,
+			want:     map[string]string{IssueNamespace: "produktyLecznicze"},
+		},
+	}
+
+	for _, test := range tests {
+		report, err := Validate(strings.NewReader(test.document))
+		if err != nil {
+			t.Errorf("%s: Validate error: %v", test.name, err)
+			continue
+		}
+
+		if report.Valid != (len(test.want) == 0) || report.TotalIssues != len(test.want) {
+			t.Errorf("%s: valid = %v with %d issues %+v, want %d issues", test.name, report.Valid, report.TotalIssues, report.Issues, len(test.want))
+			continue
+		}
+		for _, issue := range report.Issues {
+			if path, ok := test.want[issue.Kind]; !ok || issue.Path != path {
+				t.Errorf("%s: issue %s at %s, want %v", test.name, issue.Kind, issue.Path, test.want)
+			}
+			if issue.ProductID != "" && issue.ProductID != "1" {
+				t.Errorf("%s: issue of product %q, want %q", test.name, issue.ProductID, "1")
+			}
+		}
+	}
+}
+
+func TestValidateInvalidDocuments(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+	}{
+		{"empty", ""},
+		{"other root element", `<produkty xmlns="` + model.Namespace + `"/>`},
+		{"malformed", document(`<produktLeczniczy id="1">`)},
+	}
+
+	for _, test := range tests {
+		if _, err := Validate(strings.NewReader(test.document)); err == nil {
+			t.Errorf("%s: Validate succeeded, want an error", test.name)
+		}
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	dir := t.TempDir()
+	content := document(`<produktLeczniczy id="1"/><produktLeczniczy id="2" nowyAtrybut="x"/>`)
+
+	plain := filepath.Join(dir, "export.xml")
+	if err := os.WriteFile(plain, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	compressed := filepath.Join(dir, "export.xml.gz")
+	file, err := os.Create(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(file)
+	gz.Write([]byte(content))
+	gz.Close()
+	file.Close()
+
+	for _, filename := range []string{plain, compressed} {
+		report, err := ValidateFile(filename)
+		if err != nil {
+			t.Errorf("ValidateFile(%s): %v", filepath.Base(filename), err)
+			continue
+		}
+		if report.File != filename || report.Products != 2 || report.IssueCounts[IssueUnknownAttribute] != 1 {
+			t.Errorf("ValidateFile(%s) = %+v, want 2 products and one unknown attribute", filepath.Base(filename), report)
+		}
+		if report.Issues[0].ProductID != "2" {
+			t.Errorf("ValidateFile(%s) issue of product %q, want %q", filepath.Base(filename), report.Issues[0].ProductID, "2")
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"gorpl/internal/diff"
+)
+
+// maxDeliveries is the number of deliveries kept in the delivery log
+const maxDeliveries = 500
+
+// EventRegistryChanged is the event sent when the registry data changes
+const EventRegistryChanged = "registry.changed"
+
+// Payload is the JSON body sent to webhooks
+type Payload struct {
+	Event      string        `json:"event"`
+	DeliveryID string        `json:"deliveryId"`
+	From       string        `json:"from"`
+	To         string        `json:"to"`
+	FromFile   string        `json:"fromFile"`
+	ToFile     string        `json:"toFile"`
+	CreatedAt  time.Time     `json:"createdAt"`
+	Changes    []diff.Change `json:"changes"`
+}
+
+// Delivery describes an attempt to notify a webhook
+type Delivery struct {
+	ID          string     `json:"id"`
+	WebhookID   string     `json:"webhookId"`
+	URL         string     `json:"url"`
+	Changes     int        `json:"changes"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	Attempts    int        `json:"attempts"`
+	StatusCode  int        `json:"statusCode,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	Delivered   bool       `json:"delivered"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+// Notifier keeps the registered webhooks and delivers change notifications to them
+type Notifier struct {
+	Client      *http.Client
+	MaxAttempts int
+	RetryDelay  time.Duration
+
+	file       string
+	mutex      sync.Mutex
+	webhooks   []*Webhook
+	deliveries []*Delivery
+}
+
+// NewNotifier creates a new Notifier with webhooks registered in the given file
+func NewNotifier(file string, client *http.Client, maxAttempts int) (*Notifier, error) {
+	webhooks, err := loadWebhooks(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Notifier{
+		Client:      client,
+		MaxAttempts: maxAttempts,
+		RetryDelay:  5 * time.Second,
+		file:        file,
+		webhooks:    webhooks,
+	}, nil
+}
+
+// Add registers a webhook, a secret is generated when none is given
+func (n *Notifier) Add(hook Webhook) (*Webhook, error) {
+	if err := hook.check(); err != nil {
+		return nil, err
+	}
+
+	hook.ID = randomID(8)
+	hook.CreatedAt = time.Now()
+	if hook.Secret == "" {
+		hook.Secret = randomID(16)
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	webhooks := append(n.webhooks, &hook)
+	if err := saveWebhooks(n.file, webhooks); err != nil {
+		return nil, err
+	}
+	n.webhooks = webhooks
+
+	return &hook, nil
+}
+
+// Remove unregisters a webhook
+func (n *Notifier) Remove(id string) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	for i, hook := range n.webhooks {
+		if hook.ID != id {
+			continue
+		}
+
+		webhooks := append(append([]*Webhook{}, n.webhooks[:i]...), n.webhooks[i+1:]...)
+		if err := saveWebhooks(n.file, webhooks); err != nil {
+			return err
+		}
+		n.webhooks = webhooks
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrWebhookNotFound, id)
+}
+
+// List returns the registered webhooks without their secrets
+func (n *Notifier) List() []Webhook {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	webhooks := make([]Webhook, len(n.webhooks))
+	for i, hook := range n.webhooks {
+		webhooks[i] = *hook
+		webhooks[i].Secret = ""
+	}
+	return webhooks
+}
+
+// Deliveries returns the delivery log, newest first
+func (n *Notifier) Deliveries() []Delivery {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	deliveries := make([]Delivery, len(n.deliveries))
+	for i, delivery := range n.deliveries {
+		deliveries[i] = *delivery
+	}
+	return deliveries
+}
+
+// Notify sends the changes matching each webhook's filters in the background
+// Webhooks without matching changes are not notified
+func (n *Notifier) Notify(report *diff.Report) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	for _, hook := range n.webhooks {
+		var changes []diff.Change
+		for _, change := range report.Changes {
+			if hook.Matches(change) {
+				changes = append(changes, change)
+			}
+		}
+		if len(changes) == 0 {
+			continue
+		}
+
+		payload := Payload{
+			Event:      EventRegistryChanged,
+			DeliveryID: randomID(8),
+			From:       report.From,
+			To:         report.To,
+			FromFile:   report.FromFile,
+			ToFile:     report.ToFile,
+			CreatedAt:  time.Now(),
+			Changes:    changes,
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			log.Printf("Error encoding webhook payload: %v", err)
+			continue
+		}
+
+		delivery := &Delivery{
+			ID:        payload.DeliveryID,
+			WebhookID: hook.ID,
+			URL:       hook.URL,
+			Changes:   len(changes),
+			CreatedAt: payload.CreatedAt,
+		}
+		n.deliveries = append([]*Delivery{delivery}, n.deliveries...)
+		if len(n.deliveries) > maxDeliveries {
+			n.deliveries = n.deliveries[:maxDeliveries]
+		}
+
+		go n.deliver(*hook, delivery, body)
+	}
+}
+
+// deliver sends a payload to a webhook, retrying with exponential backoff
+func (n *Notifier) deliver(hook Webhook, delivery *Delivery, body []byte) {
+	delay := n.RetryDelay
+
+	for attempt := 1; ; attempt++ {
+		statusCode, err := n.send(hook, delivery.ID, body)
+		retry := err != nil && attempt < n.MaxAttempts && (statusCode == 0 || statusCode >= 500 || statusCode == http.StatusTooManyRequests)
+
+		n.mutex.Lock()
+		delivery.Attempts = attempt
+		delivery.StatusCode = statusCode
+		delivery.Error = ""
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		if !retry {
+			now := time.Now()
+			delivery.Delivered = err == nil
+			delivery.CompletedAt = &now
+		}
+		n.mutex.Unlock()
+
+		if !retry {
+			if err != nil {
+				log.Printf("Error delivering %s to webhook %s: %v", delivery.ID, hook.URL, err)
+			}
+			return
+		}
+
+		log.Printf("Webhook %s attempt %d failed: %v, retrying in %v", hook.URL, attempt, err, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// send makes a single delivery attempt and returns the HTTP status code
+func (n *Notifier) send(hook Webhook, deliveryID string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gorpl-Event", EventRegistryChanged)
+	req.Header.Set("X-Gorpl-Delivery", deliveryID)
+	req.Header.Set("X-Gorpl-Signature", Sign(hook.Secret, body))
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("invalid HTTP status: %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
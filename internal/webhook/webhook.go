@@ -0,0 +1,135 @@
+// Package webhook contains code for notifying external systems about registry changes
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gorpl/internal/database"
+	"gorpl/internal/diff"
+	"gorpl/internal/gs1"
+)
+
+// ErrWebhookNotFound is returned when a webhook with the given ID is not registered
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// ErrInvalidWebhook is returned when a webhook cannot be registered
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// Webhook describes a receiver of change notifications
+// Empty filters match all changes, otherwise a change has to match every filter that is set
+type Webhook struct {
+	ID     string `json:"id"`
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+	// Only changes of packages with one of these GTINs, or of products with such packages
+	GTINs []string `json:"gtins,omitempty"`
+	// Only changes of products with an ATC code starting with this prefix
+	ATCPrefix string `json:"atcPrefix,omitempty"`
+	// Only changes of these types, e.g. packageWithdrawn
+	Types     []string  `json:"types,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Matches reports whether a change passes the filters of the webhook
+func (w *Webhook) Matches(change diff.Change) bool {
+	// Product level changes match the GTINs of all packages of the product
+	if len(w.GTINs) > 0 && !slices.ContainsFunc(w.GTINs, func(gtin string) bool {
+		return gs1.Equal(gtin, change.GTIN) || slices.ContainsFunc(change.GTINs, func(productGtin string) bool {
+			return gs1.Equal(gtin, productGtin)
+		})
+	}) {
+		return false
+	}
+	if len(w.Types) > 0 && !slices.Contains(w.Types, change.Type) {
+		return false
+	}
+	// ATC codes are compared case-insensitively, like in ATC searches
+	if prefix := strings.ToUpper(w.ATCPrefix); prefix != "" && !slices.ContainsFunc(change.KodyATC, func(code string) bool {
+		return strings.HasPrefix(strings.ToUpper(code), prefix)
+	}) {
+		return false
+	}
+	return true
+}
+
+// check checks that a webhook can be registered and normalizes its ATC prefix
+func (w *Webhook) check() error {
+	target, err := url.Parse(w.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("%w: URL has to be an absolute http or https URL", ErrInvalidWebhook)
+	}
+
+	prefix, _, err := database.ParseAtcCode(w.ATCPrefix)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+	w.ATCPrefix = prefix
+	return nil
+}
+
+// Sign returns the signature of a payload sent in the X-Gorpl-Signature header
+// It is the hex encoded HMAC-SHA256 of the request body keyed with the webhook secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// randomID returns a random hex encoded identifier
+func randomID(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// loadWebhooks reads registered webhooks from a file, a missing file means no webhooks
+func loadWebhooks(filename string) ([]*Webhook, error) {
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading webhooks: %w", err)
+	}
+
+	var webhooks []*Webhook
+	if err := json.Unmarshal(data, &webhooks); err != nil {
+		return nil, fmt.Errorf("error decoding webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// saveWebhooks writes registered webhooks to a file
+func saveWebhooks(filename string, webhooks []*Webhook) error {
+	data, err := json.MarshalIndent(webhooks, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding webhooks: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fmt.Errorf("cannot create directory: %w", err)
+	}
+
+	tempFile := filename + ".tmp"
+	// The file contains secrets
+	if err := os.WriteFile(tempFile, data, 0600); err != nil {
+		return fmt.Errorf("error saving webhooks: %w", err)
+	}
+	if err := os.Rename(tempFile, filename); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("error saving webhooks: %w", err)
+	}
+	return nil
+}
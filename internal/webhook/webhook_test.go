@@ -0,0 +1,74 @@
+package webhook
+
+import (
+	"errors"
+	"testing"
+
+	"gorpl/internal/diff"
+)
+
+func TestMatches(t *testing.T) {
+	withdrawn := diff.Change{
+		Type:      diff.PackageWithdrawn,
+		ProductID: "1",
+		KodyATC:   []string{"N02BE01"},
+		GTIN:      "05909990022427",
+	}
+	removed := diff.Change{
+		Type:      diff.ProductRemoved,
+		ProductID: "2",
+		KodyATC:   []string{"M01AE01"},
+		GTINs:     []string{"05909990335718", "05909990335725"},
+	}
+
+	tests := []struct {
+		name    string
+		webhook Webhook
+		change  diff.Change
+		want    bool
+	}{
+		{"no filters", Webhook{}, withdrawn, true},
+		{"GTIN", Webhook{GTINs: []string{"5909990022427"}}, withdrawn, true},
+		{"other GTIN", Webhook{GTINs: []string{"5909990335718"}}, withdrawn, false},
+		{"GTIN of a product level change", Webhook{GTINs: []string{"5909990335725"}}, removed, true},
+		{"type", Webhook{Types: []string{diff.PackageWithdrawn}}, withdrawn, true},
+		{"other type", Webhook{Types: []string{diff.PackageRestored}}, withdrawn, false},
+		{"ATC prefix", Webhook{ATCPrefix: "N02"}, withdrawn, true},
+		{"lower case ATC prefix", Webhook{ATCPrefix: "n02be"}, withdrawn, true},
+		{"other ATC prefix", Webhook{ATCPrefix: "M01"}, withdrawn, false},
+		{"every filter", Webhook{GTINs: []string{"5909990022427"}, ATCPrefix: "N", Types: []string{diff.PackageWithdrawn}}, withdrawn, true},
+		{"one filter fails", Webhook{GTINs: []string{"5909990022427"}, ATCPrefix: "M"}, withdrawn, false},
+	}
+
+	for _, test := range tests {
+		if got := test.webhook.Matches(test.change); got != test.want {
+			t.Errorf("%s: Matches = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		webhook   Webhook
+		atcPrefix string
+		err       error
+	}{
+		{"valid", Webhook{URL: "https://erp.example/rpl"}, "", nil},
+		{"ATC prefix is normalized", Webhook{URL: "http://erp.example/rpl", ATCPrefix: " n02 "}, "N02", nil},
+		{"invalid ATC prefix", Webhook{URL: "https://erp.example/rpl", ATCPrefix: "N0"}, "", ErrInvalidWebhook},
+		{"relative URL", Webhook{URL: "/rpl"}, "", ErrInvalidWebhook},
+		{"other scheme", Webhook{URL: "ftp://erp.example/rpl"}, "", ErrInvalidWebhook},
+	}
+
+	for _, test := range tests {
+		err := test.webhook.check()
+		if !errors.Is(err, test.err) || (test.err == nil && err != nil) {
+			t.Errorf("%s: check error = %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if err == nil && test.webhook.ATCPrefix != test.atcPrefix {
+			t.Errorf("%s: ATC prefix = %q, want %q", test.name, test.webhook.ATCPrefix, test.atcPrefix)
+		}
+	}
+}